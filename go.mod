@@ -0,0 +1,3 @@
+module github.com/azr/generators
+
+go 1.23
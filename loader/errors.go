@@ -0,0 +1,81 @@
+package loader
+
+import (
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxErrors is the number of errors an ErrorList prints before summarizing.
+const maxErrors = 10
+
+// Error is a parse or type error found while loading a package.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e Error) Error() string {
+	if !e.Pos.IsValid() {
+		return e.Msg
+	}
+	pos := e.Pos
+	pos.Filename = relative(pos.Filename)
+	return fmt.Sprintf("%s: %s", pos, e.Msg)
+}
+
+// ErrorList holds every error found in a package that
+// does not parse or type-check.
+type ErrorList struct {
+	pkg  string
+	list []Error
+}
+
+func (l *ErrorList) append(e Error) { l.list = append(l.list, e) }
+
+// Errors returns the errors of the list.
+func (l *ErrorList) Errors() []Error { return l.list }
+
+// Without returns the errors of the list for which ignore returns false,
+// or nil if there is none.
+func (l *ErrorList) Without(ignore func(Error) bool) error {
+	kept := &ErrorList{pkg: l.pkg}
+	for _, e := range l.list {
+		if !ignore(e) {
+			kept.append(e)
+		}
+	}
+	if len(kept.list) == 0 {
+		return nil
+	}
+	return kept
+}
+
+func (l *ErrorList) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "package %s has errors, fix them and run the generator again:", l.pkg)
+	for i, e := range l.list {
+		if i == maxErrors {
+			fmt.Fprintf(&b, "\n\t(and %d more errors)", len(l.list)-maxErrors)
+			break
+		}
+		fmt.Fprintf(&b, "\n\t%s", e)
+	}
+	return b.String()
+}
+
+// relative shortens filename to a path relative to
+// the working directory when possible.
+func relative(filename string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return filename
+	}
+	rel, err := filepath.Rel(wd, filename)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filename
+	}
+	return rel
+}
@@ -0,0 +1,208 @@
+// Package loader parses and type-checks the Go package a generator works on.
+//
+// Packages are resolved exactly like the go command resolves them: the
+// dependency graph and the compiled export data of every dependency come
+// from `go list`, so go.mod files, vendor directories and replace directives
+// are all honoured, and dependencies don't need to be installed as archives.
+package loader // import "github.com/azr/generators/loader"
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/azr/generators/utils"
+)
+
+// Package is a parsed and type-checked Go package.
+type Package struct {
+	Dir   string // directory holding the package sources
+	Name  string // package name
+	Path  string // import path
+	Fset  *token.FileSet
+	Files []*ast.File // parsed with comments
+	Types *types.Package
+	Info  *types.Info
+}
+
+// Load parses and type-checks the package named by args.
+//
+// args is either a single directory or a list of Go files that
+// belong to the same package, as accepted by the generators on
+// their command line. Parse and type errors are reported as an *ErrorList;
+// on type errors the package is returned too, checked as far as possible.
+func Load(args []string) (*Package, error) {
+	dir, patterns := ".", args
+	if len(args) == 1 && utils.IsDirectory(args[0]) {
+		dir, patterns = args[0], []string{"."}
+	}
+	listed, err := goList(dir, []string{"-deps", "-export"}, patterns...)
+	if err != nil {
+		return nil, err
+	}
+
+	var target *listedPackage
+	exports := make(map[string]string)
+	for _, lp := range listed {
+		if !lp.DepOnly {
+			target = lp
+		}
+		if lp.Export != "" {
+			exports[lp.ImportPath] = lp.Export
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("%s: no package found", strings.Join(args, " "))
+	}
+	if target.Error != nil && len(target.GoFiles)+len(target.CgoFiles) == 0 {
+		return nil, fmt.Errorf("cannot load %s: %s", target.ImportPath, target.Error.Err)
+	}
+
+	pkg := &Package{
+		Dir:  target.Dir,
+		Name: target.Name,
+		Path: target.ImportPath,
+		Fset: token.NewFileSet(),
+		Info: &types.Info{
+			Types:      make(map[ast.Expr]types.TypeAndValue),
+			Defs:       make(map[*ast.Ident]types.Object),
+			Uses:       make(map[*ast.Ident]types.Object),
+			Implicits:  make(map[ast.Node]types.Object),
+			Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		},
+	}
+
+	errs := &ErrorList{pkg: target.Name}
+	for _, name := range append(target.GoFiles, target.CgoFiles...) {
+		file, err := parser.ParseFile(pkg.Fset, filepath.Join(target.Dir, name), nil, parser.ParseComments)
+		if err != nil {
+			var list scanner.ErrorList
+			if !errors.As(err, &list) {
+				return nil, err
+			}
+			for _, e := range list {
+				errs.append(Error{Pos: e.Pos, Msg: e.Msg})
+			}
+			continue
+		}
+		pkg.Files = append(pkg.Files, file)
+	}
+	if len(errs.list) > 0 {
+		return nil, errs
+	}
+	if len(pkg.Files) == 0 {
+		return nil, fmt.Errorf("%s: no buildable Go files", target.Dir)
+	}
+
+	config := types.Config{
+		FakeImportC: true,
+		Importer: &exportImporter{
+			importMap: target.ImportMap,
+			gc: importer.ForCompiler(pkg.Fset, "gc", func(path string) (io.ReadCloser, error) {
+				export, ok := exports[path]
+				if !ok {
+					return nil, fmt.Errorf("no export data for %q; does it build?", path)
+				}
+				return os.Open(export)
+			}),
+		},
+		Error: func(err error) {
+			if terr, ok := err.(types.Error); ok {
+				errs.append(Error{Pos: terr.Fset.Position(terr.Pos), Msg: terr.Msg})
+				return
+			}
+			errs.append(Error{Msg: err.Error()})
+		},
+	}
+	pkg.Types, _ = config.Check(target.ImportPath, pkg.Fset, pkg.Files, pkg.Info)
+	if len(errs.list) > 0 {
+		return pkg, errs
+	}
+	return pkg, nil
+}
+
+// PackageName returns the name of the package with the given import path,
+// as resolved from dir.
+func PackageName(dir, path string) (string, error) {
+	listed, err := goList(dir, nil, path)
+	if err != nil {
+		return "", err
+	}
+	if len(listed) != 1 {
+		return "", fmt.Errorf("%s: no package found", path)
+	}
+	if listed[0].Error != nil {
+		return "", errors.New(listed[0].Error.Err)
+	}
+	return listed[0].Name, nil
+}
+
+// exportImporter imports packages from the export data listed by go list.
+type exportImporter struct {
+	importMap map[string]string // vendored or replaced import paths
+	gc        types.Importer
+}
+
+func (imp *exportImporter) Import(path string) (*types.Package, error) {
+	if p, ok := imp.importMap[path]; ok {
+		path = p
+	}
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+	return imp.gc.Import(path)
+}
+
+// listedPackage holds the fields of `go list -json` we use.
+type listedPackage struct {
+	Dir        string
+	ImportPath string
+	Name       string
+	Export     string
+	GoFiles    []string
+	CgoFiles   []string
+	ImportMap  map[string]string
+	DepOnly    bool
+	Error      *struct {
+		Err string
+	}
+}
+
+// goList runs go list in dir and decodes the listed packages.
+func goList(dir string, flags []string, patterns ...string) ([]*listedPackage, error) {
+	args := append([]string{"list", "-e", "-json"}, flags...)
+	args = append(args, "--")
+	args = append(args, patterns...)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	var listed []*listedPackage
+	for dec := json.NewDecoder(&stdout); dec.More(); {
+		lp := new(listedPackage)
+		if err := dec.Decode(lp); err != nil {
+			return nil, fmt.Errorf("decoding go list output: %s", err)
+		}
+		listed = append(listed, lp)
+	}
+	if runErr != nil && len(listed) == 0 {
+		return nil, fmt.Errorf("go list: %s: %s", runErr, strings.TrimSpace(stderr.String()))
+	}
+	return listed, nil
+}
@@ -0,0 +1,151 @@
+package loader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeModule writes files, by path relative to dir, and returns dir.
+func writeModule(t *testing.T, dir string, files map[string]string) string {
+	t.Helper()
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeModule(t, t.TempDir(), map[string]string{
+		"go.mod": "module example.com/p\n\ngo 1.23\n",
+		"p.go": `package p
+
+import "net/http"
+
+func Get(r *http.Request) string { return r.URL.Path }
+`,
+	})
+	pkg, err := Load([]string{dir})
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	if pkg.Name != "p" || pkg.Path != "example.com/p" {
+		t.Errorf("Load = package %s %q, want p %q", pkg.Name, pkg.Path, "example.com/p")
+	}
+	if len(pkg.Files) != 1 {
+		t.Errorf("Load parsed %d files, want 1", len(pkg.Files))
+	}
+	if pkg.Types.Scope().Lookup("Get") == nil {
+		t.Error("Load: Get is not in the scope of the package")
+	}
+}
+
+func TestLoadFiles(t *testing.T) {
+	dir := writeModule(t, t.TempDir(), map[string]string{
+		"go.mod": "module example.com/p\n\ngo 1.23\n",
+		"a.go":   "package p\n\nconst A = B\n",
+		"b.go":   "package p\n\nconst B = 1\n",
+		"c.go":   "package p\n\nconst C = undefinedInC\n",
+	})
+	pkg, err := Load([]string{filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")})
+	if err != nil {
+		t.Fatalf("Load of the files a.go and b.go: %s", err)
+	}
+	if len(pkg.Files) != 2 {
+		t.Errorf("Load parsed %d files, want 2", len(pkg.Files))
+	}
+}
+
+func TestLoadReplacedModule(t *testing.T) {
+	root := t.TempDir()
+	writeModule(t, filepath.Join(root, "dep"), map[string]string{
+		"go.mod": "module example.com/dep\n\ngo 1.23\n",
+		"dep.go": "package dep\n\ntype ID string\n",
+	})
+	dir := writeModule(t, filepath.Join(root, "p"), map[string]string{
+		"go.mod": "module example.com/p\n\ngo 1.23\n\nrequire example.com/dep v0.0.0\n\nreplace example.com/dep => ../dep\n",
+		"p.go":   "package p\n\nimport \"example.com/dep\"\n\nvar ID dep.ID\n",
+	})
+	pkg, err := Load([]string{dir})
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	if got := pkg.Types.Scope().Lookup("ID").Type().String(); got != "example.com/dep.ID" {
+		t.Errorf("type of ID = %s, want example.com/dep.ID", got)
+	}
+}
+
+func TestLoadParseError(t *testing.T) {
+	dir := writeModule(t, t.TempDir(), map[string]string{
+		"go.mod": "module example.com/p\n\ngo 1.23\n",
+		"p.go":   "package p\n\nfunc F() {\n",
+	})
+	pkg, err := Load([]string{dir})
+	if pkg != nil {
+		t.Error("Load returned a package that does not parse")
+	}
+	var list *ErrorList
+	if !errors.As(err, &list) {
+		t.Fatalf("Load = %v, want an *ErrorList", err)
+	}
+	e := list.Errors()[0]
+	if filepath.Base(e.Pos.Filename) != "p.go" || e.Pos.Line != 3 {
+		t.Errorf("parse error at %s, want p.go:3", e.Pos)
+	}
+}
+
+func TestLoadTypeError(t *testing.T) {
+	dir := writeModule(t, t.TempDir(), map[string]string{
+		"go.mod": "module example.com/p\n\ngo 1.23\n",
+		"p.go":   "package p\n\nvar X = Missing\n\nvar Y int = \"y\"\n",
+	})
+	pkg, err := Load([]string{dir})
+	if pkg == nil || pkg.Types == nil {
+		t.Fatal("Load returned no package, want it checked as far as possible")
+	}
+	var list *ErrorList
+	if !errors.As(err, &list) || len(list.Errors()) != 2 {
+		t.Fatalf("Load = %v, want an *ErrorList of 2 errors", err)
+	}
+	if msg := list.Errors()[0].Msg; msg != "undefined: Missing" {
+		t.Errorf("first error = %q, want %q", msg, "undefined: Missing")
+	}
+	if !strings.HasPrefix(err.Error(), "package p has errors") {
+		t.Errorf("error = %q, want it to name the package", err)
+	}
+
+	rest := list.Without(func(e Error) bool { return strings.HasPrefix(e.Msg, "undefined: ") })
+	if rest == nil || len(rest.(*ErrorList).Errors()) != 1 {
+		t.Errorf("Without undefined errors = %v, want the other error", rest)
+	}
+	if err := list.Without(func(Error) bool { return true }); err != nil {
+		t.Errorf("Without every error = %v, want nil", err)
+	}
+}
+
+func TestErrorListSummary(t *testing.T) {
+	list := &ErrorList{pkg: "p"}
+	for i := 0; i < maxErrors+3; i++ {
+		list.append(Error{Msg: "bad"})
+	}
+	if got := list.Error(); !strings.HasSuffix(got, "(and 3 more errors)") {
+		t.Errorf("Error() = %q, want the errors past %d summarized", got, maxErrors)
+	}
+}
+
+func TestLoadNoPackage(t *testing.T) {
+	dir := writeModule(t, t.TempDir(), map[string]string{
+		"go.mod": "module example.com/p\n\ngo 1.23\n",
+	})
+	if _, err := Load([]string{dir}); err == nil {
+		t.Error("Load of a directory without Go files succeeded")
+	}
+}
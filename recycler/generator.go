@@ -5,10 +5,7 @@ import (
 	"flag"
 	"fmt"
 	"go/ast"
-	"go/build"
 	"go/format"
-	"go/importer"
-	"go/parser"
 	"go/token"
 	"go/types"
 	"io/ioutil"
@@ -19,6 +16,7 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/azr/generators/loader"
 	"github.com/azr/generators/utils"
 )
 
@@ -86,11 +84,10 @@ func main() {
 
 	if len(args) == 1 && isDirectory(args[0]) {
 		dir = args[0]
-		g.parsePackageDir(args[0])
 	} else {
 		dir = filepath.Dir(args[0])
-		g.parsePackageFiles(args)
 	}
+	g.parsePackage(args)
 
 	// Print the header and package clause.
 	g.Printf("// Code generated by \"github.com/azr/generators/recycler %s\"; DO NOT EDIT\n", strings.Join(os.Args[1:], " "))
@@ -159,87 +156,25 @@ type Package struct {
 	typesPkg *types.Package
 }
 
-// parsePackageDir parses the package residing in the directory.
-func (g *Generator) parsePackageDir(directory string) {
-	pkg, err := build.Default.ImportDir(directory, 0)
+// parsePackage loads the package named by args: a single directory
+// or a set of files. parsePackage exits if the package has errors.
+func (g *Generator) parsePackage(args []string) {
+	pkg, err := loader.Load(args)
 	if err != nil {
-		log.Fatalf("cannot process directory %s: %s", directory, err)
-	}
-	var names []string
-	names = append(names, pkg.GoFiles...)
-	names = append(names, pkg.CgoFiles...)
-	// TODO: Need to think about constants in test files. Maybe write type_string_test.go
-	// in a separate pass? For later.
-	// names = append(names, pkg.TestGoFiles...) // These are also in the "foo" package.
-	names = append(names, pkg.SFiles...)
-	names = prefixDirectory(directory, names)
-	g.parsePackage(directory, names, nil)
-}
-
-// parsePackageFiles parses the package occupying the named files.
-func (g *Generator) parsePackageFiles(names []string) {
-	g.parsePackage(".", names, nil)
-}
-
-// prefixDirectory places the directory name on the beginning of each name in the list.
-func prefixDirectory(directory string, names []string) []string {
-	if directory == "." {
-		return names
+		log.Fatal(err)
 	}
-	ret := make([]string, len(names))
-	for i, name := range names {
-		ret[i] = filepath.Join(directory, name)
+	g.pkg = &Package{
+		dir:      pkg.Dir,
+		name:     pkg.Name,
+		defs:     pkg.Info.Defs,
+		typesPkg: pkg.Types,
 	}
-	return ret
-}
-
-// parsePackage analyzes the single package constructed from the named files.
-// If text is non-nil, it is a string to be used instead of the content of the file,
-// to be used for testing. parsePackage exits if there is an error.
-func (g *Generator) parsePackage(directory string, names []string, text interface{}) {
-	var files []*File
-	var astFiles []*ast.File
-	g.pkg = new(Package)
-	fs := token.NewFileSet()
-	for _, name := range names {
-		if !strings.HasSuffix(name, ".go") {
-			continue
-		}
-		parsedFile, err := parser.ParseFile(fs, name, text, 0)
-		if err != nil {
-			log.Fatalf("parsing package: %s: %s", name, err)
-		}
-		astFiles = append(astFiles, parsedFile)
-		files = append(files, &File{
-			file: parsedFile,
+	for _, file := range pkg.Files {
+		g.pkg.files = append(g.pkg.files, &File{
+			file: file,
 			pkg:  g.pkg,
 		})
 	}
-	if len(astFiles) == 0 {
-		log.Fatalf("%s: no buildable Go files", directory)
-	}
-	g.pkg.name = astFiles[0].Name.Name
-	g.pkg.files = files
-	g.pkg.dir = directory
-	// Type check the package.
-	g.pkg.check(fs, astFiles)
-}
-
-// check type-checks the package. The package must be OK to proceed.
-func (pkg *Package) check(fs *token.FileSet, astFiles []*ast.File) {
-	pkg.defs = make(map[*ast.Ident]types.Object)
-	config := types.Config{
-		FakeImportC: true,
-		Importer:    importer.Default(),
-	}
-	info := &types.Info{
-		Defs: pkg.defs,
-	}
-	typesPkg, err := config.Check(pkg.dir, fs, astFiles, info)
-	if err != nil {
-		log.Fatalf("checking package: %s", err)
-	}
-	pkg.typesPkg = typesPkg
 }
 
 // generate produces the String method for the named type.
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"reflect"
+)
+
+// bindingTags are the struct tags telling from where in
+// the request a field of a param is set, in order of precedence.
+var bindingTags = []string{"path", "query", "header", "cookie", "form", "file", "body"}
+
+// bodyFormats are the formats a body tag can decode,
+// the only one a body of the request is decoded from.
+var bodyFormats = codecs
+
+// Binding is a field of a struct param set from the request,
+// as told by its struct tag:
+//  type ListUsers struct {
+//      Limit int `query:"limit"`
+//  }
+type Binding struct {
+	Field string     // name of the field
+	In    string     // one of bindingTags
+	Name  string     // name of the value in the request, format for a body
+	Type  types.Type // of the field
+
+	// helper func parsing the value into the field,
+	// "" for a body or an encoding.TextUnmarshaler,
+	// the helper setting it from the multipart form for a file
+	Setter string
+}
+
+// Opens tells whether b opens a file, to be closed with CloseFormFile.
+func (b Binding) Opens() bool {
+	return b.Setter == "OpenFormFile"
+}
+
+// Source returns the expression reading the value of b from r,
+// cookieValue being the name of the CookieValue helper.
+func (b Binding) Source(cookieValue string) string {
+	switch b.In {
+	case "path":
+		return fmt.Sprintf("r.PathValue(%q)", b.Name)
+	case "query":
+		return fmt.Sprintf("r.URL.Query().Get(%q)", b.Name)
+	case "header":
+		return fmt.Sprintf("r.Header.Get(%q)", b.Name)
+	case "cookie":
+		return fmt.Sprintf("%s(r, %q)", cookieValue, b.Name)
+	case "form":
+		return fmt.Sprintf("r.FormValue(%q)", b.Name)
+	}
+	return ""
+}
+
+// parseBindings returns the bindings of the fields of
+// the struct t, or t points to, that have a binding tag.
+func (pkg *Package) parseBindings(t types.Type) ([]Binding, error) {
+	st, ok := deref(t).Underlying().(*types.Struct)
+	if !ok {
+		return nil, nil
+	}
+	var bindings []Binding
+	body := ""
+	for i := 0; i < st.NumFields(); i++ {
+		field, tag := st.Field(i), reflect.StructTag(st.Tag(i))
+		for _, in := range bindingTags {
+			name, ok := tag.Lookup(in)
+			if !ok {
+				continue
+			}
+			if !field.Exported() && field.Pkg() != pkg.typesPkg {
+				return nil, fmt.Errorf("field %s is not exported", field.Name())
+			}
+			b := Binding{Field: field.Name(), In: in, Name: name, Type: field.Type()}
+			if in == "body" {
+				if body != "" {
+					return nil, fmt.Errorf("fields %s and %s both read the body", body, field.Name())
+				}
+				if !contains(bodyFormats, name) {
+					return nil, fmt.Errorf("field %s: unknown body format %q, expected one of %v", field.Name(), name, bodyFormats)
+				}
+				body = field.Name()
+			} else if in == "file" {
+				if b.Name == "" {
+					b.Name = field.Name()
+				}
+				if b.Setter = fileSetter(field.Type()); b.Setter == "" {
+					return nil, fmt.Errorf("field %s: cannot set a %s from a file, expected a *multipart.FileHeader, a []*multipart.FileHeader or an io.Reader", field.Name(), field.Type())
+				}
+			} else {
+				if b.Name == "" {
+					b.Name = field.Name()
+				}
+				setter, err := setterOf(field.Type())
+				if err != nil {
+					return nil, fmt.Errorf("field %s: %s", field.Name(), err)
+				}
+				b.Setter = setter
+			}
+			bindings = append(bindings, b)
+			break
+		}
+	}
+	return bindings, nil
+}
+
+// setterOf returns the helper func setting a value of type t from
+// a string, or "" when *t implements encoding.TextUnmarshaler.
+func setterOf(t types.Type) (string, error) {
+	if isTextUnmarshaler(types.NewPointer(t)) {
+		return "", nil
+	}
+	if isNamed(t, "time", "Duration") {
+		return "SetDuration", nil
+	}
+	if basic, ok := t.Underlying().(*types.Basic); ok {
+		info := basic.Info()
+		switch {
+		case info&types.IsString != 0:
+			return "SetString", nil
+		case info&types.IsUnsigned != 0:
+			return "SetUint", nil
+		case info&types.IsInteger != 0:
+			return "SetInt", nil
+		case info&types.IsFloat != 0:
+			return "SetFloat", nil
+		case info&types.IsBoolean != 0:
+			return "SetBool", nil
+		}
+	}
+	return "", fmt.Errorf("cannot set a %s from a string", t)
+}
+
+// fileSetter returns the helper func setting a value of type t from the
+// files of a multipart form: the first *multipart.FileHeader, all of them
+// for a []*multipart.FileHeader, or the first opened for an io.Reader,
+// an io.ReadCloser or a multipart.File. It returns "" for other types.
+func fileSetter(t types.Type) string {
+	isFileHeader := func(t types.Type) bool {
+		p, ok := types.Unalias(t).(*types.Pointer)
+		return ok && isNamed(p.Elem(), "mime/multipart", "FileHeader")
+	}
+	switch {
+	case isFileHeader(t):
+		return "SetFormFile"
+	case isNamed(t, "io", "Reader"), isNamed(t, "io", "ReadCloser"), isNamed(t, "mime/multipart", "File"):
+		return "OpenFormFile"
+	}
+	if s, ok := types.Unalias(t).(*types.Slice); ok && isFileHeader(s.Elem()) {
+		return "SetFormFiles"
+	}
+	return ""
+}
+
+// isTextUnmarshaler reports whether t has the method
+//  UnmarshalText(text []byte) error
+func isTextUnmarshaler(t types.Type) bool {
+	obj, _, _ := types.LookupFieldOrMethod(t, false, nil, "UnmarshalText")
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return false
+	}
+	sig := fn.Type().(*types.Signature)
+	return sig.Params().Len() == 1 &&
+		types.Identical(sig.Params().At(0).Type(), types.NewSlice(types.Typ[types.Byte])) &&
+		sig.Results().Len() == 1 && isError(sig.Results().At(0).Type())
+}
+
+// deref returns the type t points to, or t.
+func deref(t types.Type) types.Type {
+	t = types.Unalias(t)
+	if p, ok := t.(*types.Pointer); ok {
+		return types.Unalias(p.Elem())
+	}
+	return t
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
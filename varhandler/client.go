@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// clientName is the type of the generated client.
+const clientName = "Client"
+
+// clientLocals are the names used by the generated client methods,
+// params that have one of these names are renamed.
+var clientLocals = []string{"c", "ctx", "req", "resp", "status", "err"}
+
+// clientMethod is a method of the generated client,
+// calling the handler of a func over http.
+type clientMethod struct {
+	FuncDefinition
+	Method, Pattern string
+
+	// Args of the method, context excluded
+	Args []clientArg
+
+	// type returned by the method: the response type of the func,
+	// []byte when the response is an interface or an io.Reader,
+	// []T for a stream of values of type T
+	Result types.Type
+
+	// media type the method accepts, for the response to be one
+	// it decodes, if the handler negotiates it
+	Accept string
+}
+
+// clientArg is a param of a client method
+// and how it is encoded into the request.
+type clientArg struct {
+	Name string
+	Type types.Type
+	Sets []string // statements encoding the arg
+}
+
+// Pointer tells whether the result of m is a pointer
+func (m clientMethod) Pointer() bool {
+	_, ok := types.Unalias(m.Result).(*types.Pointer)
+	return ok
+}
+
+// Elem returns the type the result of m points to, or its type
+func (m clientMethod) Elem() types.Type {
+	return deref(m.Result)
+}
+
+// writeClient writes to path the client of the definitions that have routes.
+// It exits if a param can't be encoded the way its instantiator reads it.
+func (g *Generator) writeClient(path string, definitions []FuncDefinition) {
+	if obj := g.pkg.typesPkg.Scope().Lookup(clientName); obj != nil && !sameFile(g.pkg.fset.Position(obj.Pos()).Filename, path) {
+		log.Fatalf("%s is already declared at %s", clientName, g.pkg.fset.Position(obj.Pos()))
+	}
+	c := Generator{pkg: g.pkg, helpers: g.helpers}
+	c.imports.add("context", "context", "")
+	c.imports.add("net/http", "http", "")
+
+	var methods []clientMethod
+	for _, fd := range definitions {
+		if fd.Name == "" {
+			continue
+		}
+		if len(fd.Routes) == 0 {
+			log.Printf("%s has no route, it is left out of %s", fd.Name, path)
+			continue
+		}
+		m, err := fd.clientMethod()
+		if err != nil {
+			log.Fatalf("%s: client: %s", fd.Name, err)
+		}
+		methods = append(methods, m)
+	}
+
+	funcMap := template.FuncMap{
+		"Type":   c.typeString,
+		"Helper": c.helper,
+	}
+	t := template.Must(template.New("client").Funcs(funcMap).Parse(clientWrap))
+	var body Generator
+	body.pkg = g.pkg
+	err := t.Execute(&body.buf, struct {
+		Name    string
+		Methods []clientMethod
+	}{clientName, methods})
+	checkError(err)
+
+	c.Printf("// Code generated by \"varhandler %s\"; DO NOT EDIT\n", strings.Join(os.Args[1:], " "))
+	c.Printf("\n")
+	c.Printf("package %s\n", g.pkg.name)
+	c.Printf("\n")
+	c.imports.print(&c)
+	c.Printf("%s", body.buf.String())
+
+	if err := ioutil.WriteFile(path, c.format(), 0644); err != nil {
+		log.Fatalf("writing client: %s", err)
+	}
+}
+
+// clientMethod returns the client method of fd,
+// called with the first route of fd.
+func (fd FuncDefinition) clientMethod() (clientMethod, error) {
+	m := clientMethod{FuncDefinition: fd, Method: "GET"}
+	pattern := fd.Routes[0]
+	if method, path, ok := strings.Cut(pattern, " "); ok {
+		m.Method, pattern = method, strings.TrimSpace(path)
+	}
+	if i := strings.Index(pattern, "/"); i > 0 {
+		pattern = pattern[i:] // host, the base url of the client is used
+	}
+	m.Pattern = pattern
+
+	if fd.Response {
+		t := fd.ResponseType
+		m.Result = t
+		switch {
+		case streamElem(t) != nil:
+			m.Result = types.NewSlice(streamElem(t))
+			m.Accept = "application/x-ndjson"
+		case types.IsInterface(t) || isReader(t):
+			m.Result = types.NewSlice(types.Universe.Lookup("byte").Type())
+		case !hasMethod(t, "ServeHTTP") && !hasMethod(t, "Bytes") &&
+			!types.Identical(t.Underlying(), types.NewSlice(types.Typ[types.Byte])):
+			// a Stringer would be answered as text/plain
+			m.Accept = codecMediaTypes[fd.Codec]
+		}
+	}
+
+	wildcards, _ := checkRoute(fd.Routes[0])
+	custom := false // an EncodeHTTP method can set anything
+	set := make(map[string]bool)
+	seen := make(map[string]bool) // vars of the params already taken
+	params := fd.Params
+	for len(params) > 0 {
+		param := params[0]
+		params = params[1:]
+		if seen[param.Var] {
+			continue
+		}
+		seen[param.Var] = true
+		arg := clientArg{Name: param.Arg, Type: param.Type}
+		if contains(clientLocals, arg.Name) || m.hasArg(arg.Name) {
+			arg.Name = param.Var
+		}
+		switch {
+		case hasEncodeHTTP(param.Type):
+			custom = true
+			arg.Sets = append(arg.Sets, fmt.Sprintf("req.Encode(%s.EncodeHTTP)", arg.Name))
+		case param.Bindings != nil:
+			for _, b := range param.Bindings {
+				expr := arg.Name
+				if b.Field != "" {
+					expr += "." + b.Field
+				}
+				s, err := encodeInput(b, b.Type, expr)
+				if err != nil {
+					return m, fmt.Errorf("field %s of %s: %s", b.Field, param.Name, err)
+				}
+				arg.Sets = append(arg.Sets, s)
+				set[b.In+" "+b.Name] = true
+			}
+		case len(param.Inputs) == 1:
+			input := param.Inputs[0]
+			if input.In == "body" && !types.Identical(input.Type, param.Elem()) {
+				return m, fmt.Errorf("%s decodes a %s from the body, not a %s", param.GeneratorName, input.Type, param.Name)
+			}
+			s, err := encodeInput(input, param.Type, arg.Name)
+			if err != nil {
+				return m, fmt.Errorf("%s reads %s value %q: %s", param.GeneratorName, input.In, input.Name, err)
+			}
+			arg.Sets = append(arg.Sets, s)
+			set[input.In+" "+input.Name] = true
+		case len(param.Inputs) == 0 && len(param.Deps) > 0:
+			// made of the params its generator takes: take them instead
+			for _, dep := range param.Deps {
+				params = append(params, fd.instantiation(dep))
+			}
+			continue
+		default:
+			return m, fmt.Errorf("cannot tell how %s reads a %s, give %s a method\n\tEncodeHTTP(r *http.Request) error", param.GeneratorName, param.Name, param.Name)
+		}
+		m.Args = append(m.Args, arg)
+	}
+	for _, wildcard := range wildcards {
+		if !custom && !set["path "+wildcard] {
+			return m, fmt.Errorf("route %q: no param sets wildcard %s", fd.Routes[0], wildcard)
+		}
+	}
+	return m, nil
+}
+
+// hasArg tells whether m has an arg named name.
+func (m clientMethod) hasArg(name string) bool {
+	for _, arg := range m.Args {
+		if arg.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeInput returns the statement setting the value expr,
+// of type t, into the request as input is read.
+func encodeInput(input Binding, t types.Type, expr string) (string, error) {
+	switch input.In {
+	case "body":
+		return fmt.Sprintf("req.SetBody(%q, %s)", codecMediaTypes[input.Name], expr), nil
+	case "file":
+		return fmt.Sprintf("req.SetFile(%q, %s)", input.Name, expr), nil
+	}
+	if !canFormat(t) {
+		return "", fmt.Errorf("cannot format a %s into a string", t)
+	}
+	return fmt.Sprintf("req.Set(%q, %q, %s)", input.In, input.Name, expr), nil
+}
+
+// canFormat reports whether FormatValue can format a value of type t
+// into a string its setter parses back.
+func canFormat(t types.Type) bool {
+	if isTextMarshaler(t) || isNamed(t, "time", "Duration") {
+		return true
+	}
+	basic, ok := t.Underlying().(*types.Basic)
+	return ok && basic.Info()&(types.IsString|types.IsInteger|types.IsFloat|types.IsBoolean) != 0
+}
+
+// isTextMarshaler reports whether t has the method
+//  MarshalText() (text []byte, err error)
+func isTextMarshaler(t types.Type) bool {
+	obj, _, _ := types.LookupFieldOrMethod(t, false, nil, "MarshalText")
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return false
+	}
+	sig := fn.Type().(*types.Signature)
+	return sig.Params().Len() == 0 && sig.Results().Len() == 2 &&
+		types.Identical(sig.Results().At(0).Type(), types.NewSlice(types.Typ[types.Byte])) &&
+		isError(sig.Results().At(1).Type())
+}
+
+// hasEncodeHTTP reports whether t has the method
+//  EncodeHTTP(r *http.Request) error
+func hasEncodeHTTP(t types.Type) bool {
+	obj, _, _ := types.LookupFieldOrMethod(t, true, nil, "EncodeHTTP")
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return false
+	}
+	sig := fn.Type().(*types.Signature)
+	return sig.Params().Len() == 1 && isHTTPRequest(sig.Params().At(0).Type()) &&
+		sig.Results().Len() == 1 && isError(sig.Results().At(0).Type())
+}
+
+const clientWrap = `
+// {{.Name}} calls the generated handlers over http.
+// Its methods encode their params the way instantiators
+// decode them, and decode the response.
+type {{.Name}} struct {
+	BaseURL    string       // like http://localhost:8080, with no trailing /
+	HTTPClient *http.Client // http.DefaultClient if nil
+}
+
+// do sends req and decodes the response into resp,
+// returning the status of the response.
+func (c *{{.Name}}) do(ctx context.Context, req *{{Helper "ClientRequest"}}, resp interface{}) (int, error) {
+	r, err := req.Request(ctx, c.BaseURL)
+	if err != nil {
+		return 0, err
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(r)
+	if err != nil {
+		return 0, err
+	}
+	return res.StatusCode, {{Helper "DecodeResponse"}}(res, resp)
+}
+{{range $m := .Methods}}
+// {{.Name}} calls {{.Name}}Handler with {{.Method}} {{.Pattern}}.
+func (c *{{$.Name}}) {{.Name}}(ctx context.Context{{range .Args}}, {{.Name}} {{Type .Type}}{{end}}) ({{if .Response}}resp {{Type .Result}}, {{end}}{{if .Status}}status int, {{end}}err error) {
+	req := {{Helper "NewClientRequest"}}({{printf "%q" .Method}}, {{printf "%q" .Pattern}})
+{{- if .Accept}}
+	req.Set("header", "Accept", {{printf "%q" .Accept}})
+{{- end}}
+{{- range .Args}}{{range .Sets}}
+	{{.}}
+{{- end}}{{end}}
+{{- if and .Response .Pointer}}
+	resp = new({{Type .Elem}})
+{{- end}}
+	{{if .Status}}status{{else}}_{{end}}, err = c.do(ctx, req, {{if .Response}}{{if not .Pointer}}&{{end}}resp{{else}}nil{{end}})
+	return
+}
+{{end}}
+`
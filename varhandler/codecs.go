@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"reflect"
+	"strings"
+)
+
+// codecs are the codecs responses can be encoded with, set for
+// all the funcs with -codec or for one with a directive:
+//  //varhandler:codec xml
+// EncodeResponse uses the codec of the same name from Codecs.
+var codecs = []string{"json", "xml", "gob"}
+
+// codecMediaTypes are the content types of the codecs.
+var codecMediaTypes = map[string]string{
+	"json": "application/json",
+	"xml":  "application/xml",
+	"gob":  "application/x-gob",
+}
+
+// handledResponse reports whether HandleHTTPResponse writes
+// a response of type t itself: an http.Handler,
+// a Byter, a Stringer or a []byte.
+func handledResponse(t types.Type) bool {
+	return hasMethod(t, "ServeHTTP") || hasMethod(t, "Bytes") || hasMethod(t, "String") ||
+		types.Identical(t.Underlying(), types.NewSlice(types.Typ[types.Byte]))
+}
+
+// streamElem returns the type of the values of a stream response,
+// as Stream writes them: T for a <-chan T or an iter.Seq[T], a
+// func(yield func(T) bool). It returns nil for any other type.
+func streamElem(t types.Type) types.Type {
+	switch u := t.Underlying().(type) {
+	case *types.Chan:
+		if u.Dir() != types.SendOnly {
+			return u.Elem()
+		}
+	case *types.Signature:
+		if u.Params().Len() != 1 || u.Results().Len() != 0 || u.Variadic() {
+			return nil
+		}
+		yield, ok := u.Params().At(0).Type().Underlying().(*types.Signature)
+		if ok && yield.Params().Len() == 1 && yield.Results().Len() == 1 &&
+			types.Identical(yield.Results().At(0).Type().Underlying(), types.Typ[types.Bool]) {
+			return yield.Params().At(0).Type()
+		}
+	}
+	return nil
+}
+
+// isReader reports whether a response of type t
+// is streamed by Stream as an io.Reader.
+func isReader(t types.Type) bool {
+	return hasMethod(t, "Read") && !hasMethod(t, "Bytes") && !hasMethod(t, "String")
+}
+
+// checkCodec returns an error if codec cannot encode a value of type t.
+// Interfaces can only be checked at runtime.
+func checkCodec(codec string, t types.Type) error {
+	c := codecChecker{codec: codec, seen: make(map[types.Type]bool)}
+	return c.check(t)
+}
+
+type codecChecker struct {
+	codec string
+	seen  map[types.Type]bool // types being or already checked
+}
+
+// marshalers are the methods by which a type encodes itself, by codec.
+var marshalers = map[string][]string{
+	"json": {"MarshalJSON", "MarshalText"},
+	"xml":  {"MarshalXML", "MarshalText"},
+	"gob":  {"GobEncode", "MarshalBinary"},
+}
+
+func (c *codecChecker) check(t types.Type) error {
+	t = types.Unalias(t)
+	if c.seen[t] {
+		return nil
+	}
+	c.seen[t] = true
+	for _, method := range marshalers[c.codec] {
+		obj, _, _ := types.LookupFieldOrMethod(t, true, nil, method)
+		if _, ok := obj.(*types.Func); ok {
+			return nil
+		}
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		if u.Kind() == types.UnsafePointer || u.Info()&types.IsComplex != 0 && c.codec != "gob" {
+			return fmt.Errorf("%s cannot encode a %s", c.codec, t)
+		}
+	case *types.Chan, *types.Signature:
+		return fmt.Errorf("%s cannot encode a %s", c.codec, t)
+	case *types.Pointer:
+		return c.check(u.Elem())
+	case *types.Slice:
+		return c.check(u.Elem())
+	case *types.Array:
+		return c.check(u.Elem())
+	case *types.Map:
+		if c.codec == "xml" {
+			return fmt.Errorf("xml cannot encode a map, %s", t)
+		}
+		if c.codec == "json" && !isJSONKey(u.Key()) {
+			return fmt.Errorf("json cannot encode a %s: keys must be strings, integers or encoding.TextMarshaler", t)
+		}
+		if err := c.check(u.Key()); err != nil {
+			return err
+		}
+		return c.check(u.Elem())
+	case *types.Struct:
+		return c.checkFields(t, u)
+	}
+	return nil
+}
+
+// checkFields checks the fields of st the codec encodes.
+func (c *codecChecker) checkFields(t types.Type, st *types.Struct) error {
+	exported := false
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		if !field.Exported() && !(field.Embedded() && c.codec != "gob") {
+			continue
+		}
+		name, _, _ := strings.Cut(reflect.StructTag(st.Tag(i)).Get(c.codec), ",")
+		if name == "-" {
+			continue
+		}
+		exported = true
+		if c.codec == "gob" {
+			switch field.Type().Underlying().(type) {
+			case *types.Chan, *types.Signature:
+				continue // ignored by gob
+			}
+		}
+		if err := c.check(field.Type()); err != nil {
+			return fmt.Errorf("field %s: %s", field.Name(), err)
+		}
+	}
+	if c.codec == "gob" && !exported {
+		return fmt.Errorf("gob cannot encode a %s: it has no exported fields", t)
+	}
+	return nil
+}
+
+// isJSONKey reports whether encoding/json can encode map keys of type t.
+func isJSONKey(t types.Type) bool {
+	if basic, ok := t.Underlying().(*types.Basic); ok && basic.Info()&(types.IsString|types.IsInteger) != 0 {
+		return true
+	}
+	return isTextMarshaler(t)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// directivePrefix starts the comments configuring
+// the generation of a func, in its doc:
+//  //varhandler:route GET /users/{id}
+//  func GetUser(id UserID) (User, error)
+const directivePrefix = "//varhandler:"
+
+// parseDirectives returns the arguments of the directives
+// of doc, by directive name, in order of appearance.
+func parseDirectives(doc *ast.CommentGroup) map[string][]string {
+	directives := make(map[string][]string)
+	if doc == nil {
+		return directives
+	}
+	for _, c := range doc.List {
+		if !strings.HasPrefix(c.Text, directivePrefix) {
+			continue
+		}
+		name, args, _ := strings.Cut(strings.TrimPrefix(c.Text, directivePrefix), " ")
+		directives[name] = append(directives[name], strings.TrimSpace(args))
+	}
+	return directives
+}
+
+// checkRoute checks that pattern is a valid http.ServeMux pattern,
+// like "GET /users/{id}", and returns the names of its wildcards.
+func checkRoute(pattern string) (wildcards []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	http.NewServeMux().HandleFunc(pattern, http.NotFound) // panics on invalid patterns
+
+	_, path, _ := strings.Cut(pattern, "/")
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") && segment != "{$}" {
+			wildcards = append(wildcards, strings.TrimSuffix(segment[1:len(segment)-1], "..."))
+		}
+	}
+	return wildcards, nil
+}
+
+// sizeUnits are the units of the sizes of directives, in bytes.
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+// parseSize parses a positive size in bytes, like 512, 64KB, 1MB or 2GB:
+// units are powers of 1024.
+func parseSize(s string) (int64, error) {
+	n, unit := strings.ToUpper(strings.TrimSpace(s)), int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(n, u.suffix) {
+			n, unit = strings.TrimSpace(strings.TrimSuffix(n, u.suffix)), u.bytes
+			break
+		}
+	}
+	size, err := strconv.ParseInt(n, 10, 64)
+	if err != nil || size <= 0 || size > math.MaxInt64/unit {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return size * unit, nil
+}
@@ -0,0 +1,58 @@
+//go:generate varhandler -receiver AccountService -output account_handlers_generated.go
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/azr/generators/varhandler/varhttp"
+)
+
+var ErrAccountNotFound = errors.New("account not found")
+
+func init() {
+	varhttp.RegisterErrorStatus(ErrAccountNotFound, http.StatusNotFound)
+	accounts := &AccountService{accounts: map[string]Account{
+		"1": {ID: "1", Owner: "gopher"},
+	}}
+	varhttp.HandleRoutes(http.DefaultServeMux, accounts.Routes())
+}
+
+type Account struct {
+	ID    string
+	Owner string
+}
+
+// AccountService holds the accounts its handlers serve.
+type AccountService struct {
+	mu       sync.Mutex
+	accounts map[string]Account
+}
+
+// HTTPAccount instantiates the account of the id of the path,
+// for the methods of s only.
+func (s *AccountService) HTTPAccount(r *http.Request) (Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account, ok := s.accounts[r.PathValue("id")]
+	if !ok {
+		return account, ErrAccountNotFound
+	}
+	return account, nil
+}
+
+// GetAccount returns an account.
+//varhandler:route GET /accounts/{id}
+func (s *AccountService) GetAccount(account Account) (Account, error) {
+	return account, nil
+}
+
+// DeleteAccount deletes an account.
+//varhandler:route DELETE /accounts/{id}
+func (s *AccountService) DeleteAccount(account Account) (status int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.accounts, account.ID)
+	return http.StatusNoContent, nil
+}
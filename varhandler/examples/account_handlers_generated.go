@@ -0,0 +1,97 @@
+// Code generated by "varhandler -receiver AccountService -output account_handlers_generated.go"; DO NOT EDIT
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/azr/generators/varhandler/varhttp"
+)
+
+func (s *AccountService) GetAccountHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "AccountService.GetAccount")
+	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	o.Start()
+	param0, err := s.HTTPAccount(r)
+	if err != nil {
+		o.Instantiated("Account", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("Account", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	var resp Account
+
+	o.Start()
+	resp, err = s.GetAccount(param0)
+	o.Called(err)
+	if err != nil {
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	varhttp.EncodeResponse(w, r, "application/json", 0, resp)
+
+}
+
+func (s *AccountService) DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "AccountService.DeleteAccount")
+	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	o.Start()
+	param0, err := s.HTTPAccount(r)
+	if err != nil {
+		o.Instantiated("Account", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("Account", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	var status int
+
+	o.Start()
+	status, err = s.DeleteAccount(param0)
+	o.Called(err)
+	if err != nil {
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if status != 0 {
+		w.WriteHeader(status)
+	}
+
+}
+
+// Routes returns the generated handlers of s, wrapped by their
+// middleware, with the patterns of their //varhandler:route directives,
+// see varhttp.HandleRoutes.
+func (s *AccountService) Routes() []varhttp.Route {
+	return []varhttp.Route{
+		{Pattern: "GET /accounts/{id}", Handler: http.HandlerFunc(s.GetAccountHandler)},
+		{Pattern: "DELETE /accounts/{id}", Handler: http.HandlerFunc(s.DeleteAccountHandler)},
+	}
+}
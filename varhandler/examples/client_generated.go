@@ -0,0 +1,78 @@
+// Code generated by "varhandler -func CreateUser,GetUser,GetUserCard,UpdateUser,DeleteUser -output user_handlers_generated.go -openapi openapi.json -client client_generated.go"; DO NOT EDIT
+
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/azr/generators/varhandler/varhttp"
+)
+
+// Client calls the generated handlers over http.
+// Its methods encode their params the way instantiators
+// decode them, and decode the response.
+type Client struct {
+	BaseURL    string       // like http://localhost:8080, with no trailing /
+	HTTPClient *http.Client // http.DefaultClient if nil
+}
+
+// do sends req and decodes the response into resp,
+// returning the status of the response.
+func (c *Client) do(ctx context.Context, req *varhttp.ClientRequest, resp interface{}) (int, error) {
+	r, err := req.Request(ctx, c.BaseURL)
+	if err != nil {
+		return 0, err
+	}
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(r)
+	if err != nil {
+		return 0, err
+	}
+	return res.StatusCode, varhttp.DecodeResponse(res, resp)
+}
+
+// CreateUser calls CreateUserHandler with POST /users.
+func (c *Client) CreateUser(ctx context.Context, user User) (status int, err error) {
+	req := varhttp.NewClientRequest("POST", "/users")
+	req.SetBody("application/json", user)
+	status, err = c.do(ctx, req, nil)
+	return
+}
+
+// GetUser calls GetUserHandler with GET /users/{id}.
+func (c *Client) GetUser(ctx context.Context, id UserID) (resp []byte, status int, err error) {
+	req := varhttp.NewClientRequest("GET", "/users/{id}")
+	req.Set("path", "id", id)
+	status, err = c.do(ctx, req, &resp)
+	return
+}
+
+// GetUserCard calls GetUserCardHandler with GET /users/{id}/card.
+func (c *Client) GetUserCard(ctx context.Context, id UserID) (resp UserCard, err error) {
+	req := varhttp.NewClientRequest("GET", "/users/{id}/card")
+	req.Set("header", "Accept", "application/json")
+	req.Set("path", "id", id)
+	_, err = c.do(ctx, req, &resp)
+	return
+}
+
+// UpdateUser calls UpdateUserHandler with PUT /users/{id}.
+func (c *Client) UpdateUser(ctx context.Context, id UserID, user User) (status int, err error) {
+	req := varhttp.NewClientRequest("PUT", "/users/{id}")
+	req.Set("path", "id", id)
+	req.SetBody("application/json", user)
+	status, err = c.do(ctx, req, nil)
+	return
+}
+
+// DeleteUser calls DeleteUserHandler with DELETE /users/{id}.
+func (c *Client) DeleteUser(ctx context.Context, id UserID) (status int, err error) {
+	req := varhttp.NewClientRequest("DELETE", "/users/{id}")
+	req.Set("path", "id", id)
+	status, err = c.do(ctx, req, nil)
+	return
+}
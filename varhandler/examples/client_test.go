@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/azr/generators/varhandler/varhttp"
+)
+
+func TestClientStringerResponse(t *testing.T) {
+	srv := httptest.NewServer(http.DefaultServeMux)
+	defer srv.Close()
+	c := &Client{BaseURL: srv.URL}
+
+	card, err := c.GetUserCard(context.Background(), "42")
+	if err != nil {
+		t.Fatalf("GetUserCard: %s", err)
+	}
+	if want := (UserCard{Id: "42", Name: "gopher"}); card != want {
+		t.Errorf("GetUserCard = %+v, want %+v", card, want)
+	}
+}
+
+func TestClientStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.DefaultServeMux)
+	defer srv.Close()
+	c := &Client{BaseURL: srv.URL}
+
+	_, err := c.DeleteUser(context.Background(), "1")
+	var statusErr *varhttp.StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusForbidden {
+		t.Fatalf("DeleteUser without X-Admin = %v, want a %d StatusError", err, http.StatusForbidden)
+	}
+	if statusErr.Problem == nil || statusErr.Problem.Detail != "admins only" {
+		t.Errorf("DeleteUser problem = %+v, want the detail of the middleware", statusErr.Problem)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+//go:generate varhandler -func Context
+func Context(ctx context.Context, x X, s Session) error {
+	return ctx.Err()
+}
+
+type Session struct {
+	ID string
+}
+
+func HTTPSession(ctx context.Context, r *http.Request) (Session, error) {
+	c, err := r.Cookie("session")
+	if err != nil {
+		return Session{}, err
+	}
+	return Session{ID: c.Value}, ctx.Err()
+}
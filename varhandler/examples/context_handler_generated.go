@@ -0,0 +1,56 @@
+// Code generated by "varhandler -func Context"; DO NOT EDIT
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/azr/generators/varhandler/varhttp"
+)
+
+func ContextHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "Context")
+	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	o.Start()
+	param0, err := HTTPX(r)
+	if err != nil {
+		o.Instantiated("X", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("X", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	o.Start()
+	param1, err := HTTPSession(ctx, r)
+	if err != nil {
+		o.Instantiated("Session", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("Session", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	o.Start()
+	err = Context(ctx, param0, param1)
+	o.Called(err)
+	if err != nil {
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+}
@@ -0,0 +1,39 @@
+//go:generate varhandler -func GetProfile -register RegisterProfileHandlers
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func init() {
+	RegisterProfileHandlers(http.DefaultServeMux)
+}
+
+type Profile struct {
+	User UserID
+	Bio  string
+}
+
+var profiles = map[UserID]Profile{
+	"1": {User: "1", Bio: "gopher"},
+}
+
+// HTTPProfile takes the UserID HTTPUserID parsed
+// instead of reading the path again.
+// Its errors are answered with a 404, not a 400.
+//varhandler:status 404
+func HTTPProfile(r *http.Request, uid UserID) (Profile, error) {
+	p, ok := profiles[uid]
+	if !ok {
+		return p, fmt.Errorf("user %s has no profile", uid)
+	}
+	return p, nil
+}
+
+// GetProfile returns the profile of a user.
+// HTTPUserID is called once, for uid and for HTTPProfile.
+//varhandler:route GET /users/{id}/profile
+func GetProfile(uid UserID, p Profile) (Profile, error) {
+	return p, nil
+}
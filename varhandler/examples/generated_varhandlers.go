@@ -2,34 +2,69 @@
 
 package main
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/azr/generators/varhandler/varhttp"
+)
 
 func StatusHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "Status")
 	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
 
+	o.Start()
 	param0, err := HTTPX(r)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		o.Instantiated("X", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("X", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
 		return
 	}
 
+	o.Start()
 	param1, err := HTTPY(r)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		o.Instantiated("Y", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("Y", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
 		return
 	}
 
+	o.Start()
 	param2, err := HTTPZ(r)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		o.Instantiated("*Z", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("*Z", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
 		return
 	}
 
 	var status int
 
+	o.Start()
 	status, err = Status(param0, param1, param2)
+	o.Called(err)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -40,58 +75,116 @@ func StatusHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func ResponseHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "Response")
 	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
 
+	o.Start()
 	param0, err := HTTPX(r)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		o.Instantiated("X", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("X", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
 		return
 	}
 
+	o.Start()
 	param1, err := HTTPY(r)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		o.Instantiated("Y", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("Y", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
 		return
 	}
 
+	o.Start()
 	param2, err := HTTPZ(r)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		o.Instantiated("*Z", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("*Z", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
 		return
 	}
 
 	var resp interface{}
 
+	o.Start()
 	resp, err = Response(param0, param1, param2)
+	o.Called(err)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	if resp != nil {
-		HandleHTTPResponse(w, r, resp)
-	}
+	varhttp.EncodeResponse(w, r, "application/json", 0, resp)
 
 }
 
 func ResponseStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "ResponseStatus")
 	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
 
+	o.Start()
 	param0, err := HTTPX(r)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		o.Instantiated("X", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("X", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
 		return
 	}
 
+	o.Start()
 	param1, err := HTTPY(r)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		o.Instantiated("Y", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("Y", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
 		return
 	}
 
+	o.Start()
 	param2, err := HTTPZ(r)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		o.Instantiated("*Z", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("*Z", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
 		return
 	}
 
@@ -99,18 +192,14 @@ func ResponseStatusHandler(w http.ResponseWriter, r *http.Request) {
 
 	var status int
 
+	o.Start()
 	resp, status, err = ResponseStatus(param0, param1, param2)
+	o.Called(err)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	if status != 0 {
-		w.WriteHeader(status)
-	}
-
-	if resp != nil {
-		HandleHTTPResponse(w, r, resp)
-	}
+	varhttp.EncodeResponse(w, r, "application/json", status, resp)
 
 }
@@ -0,0 +1,66 @@
+// Code generated by "varhandler -func GetProfile -register RegisterProfileHandlers"; DO NOT EDIT
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/azr/generators/varhandler/varhttp"
+)
+
+func GetProfileHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "GetProfile")
+	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	o.Start()
+	param0, err := HTTPUserID(r)
+	if err != nil {
+		o.Instantiated("UserID", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("UserID", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	o.Start()
+	param1, err := HTTPProfile(r, param0)
+	if err != nil {
+		o.Instantiated("Profile", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusNotFound, err)
+		return
+	}
+	o.Instantiated("Profile", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	var resp Profile
+
+	o.Start()
+	resp, err = GetProfile(param0, param1)
+	o.Called(err)
+	if err != nil {
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	varhttp.EncodeResponse(w, r, "application/json", 0, resp)
+
+}
+
+// RegisterProfileHandlers registers on mux the generated handlers, wrapped by
+// their middleware, with the patterns of their //varhandler:route directives.
+func RegisterProfileHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("GET /users/{id}/profile", GetProfileHandler)
+}
@@ -2,21 +2,42 @@
 
 package main
 
-import "net/http"
-import z "github.com/azr/generators/varhandler/examples/z"
+import (
+	"net/http"
+
+	"github.com/azr/generators/varhandler/examples/z"
+	"github.com/azr/generators/varhandler/varhttp"
+)
 
 func ImportHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "Import")
 	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
 
+	o.Start()
 	param0, err := z.HTTPZ(r)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		o.Instantiated("github.com/azr/generators/varhandler/examples/z.Z", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("github.com/azr/generators/varhandler/examples/z.Z", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
 		return
 	}
 
+	o.Start()
 	err = Import(param0)
+	o.Called(err)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -0,0 +1,77 @@
+//go:generate varhandler -interface NoteAPI -output noteapi_handler_generated.go
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/azr/generators/varhandler/varhttp"
+)
+
+var ErrNoteNotFound = errors.New("note not found")
+
+func init() {
+	varhttp.RegisterErrorStatus(ErrNoteNotFound, http.StatusNotFound)
+	http.Handle("/notes/", NewNoteAPIHandler(&memNotes{notes: map[NoteID]Note{}}))
+}
+
+type NoteID string
+
+func HTTPNoteID(r *http.Request) (NoteID, error) {
+	id := NoteID(r.PathValue("id"))
+	if id == "" {
+		return id, errors.New("Please provide a note id")
+	}
+	return id, nil
+}
+
+type Note struct {
+	ID   NoteID `json:"id"`
+	Text string `json:"text"`
+}
+
+// NoteDraft is the content of a note to save.
+type NoteDraft struct {
+	ID   NoteID `path:"id"`
+	Text string `body:"json"`
+}
+
+// NoteAPI is the contract of the notes endpoints:
+// NewNoteAPIHandler serves any implementation of it.
+type NoteAPI interface {
+	// GetNote returns a note.
+	//varhandler:route GET /notes/{id}
+	GetNote(ctx context.Context, id NoteID) (Note, error)
+
+	// PutNote saves a note, of 64KB at most,
+	// rejecting unknown fields.
+	//varhandler:route PUT /notes/{id}
+	//varhandler:maxbody 64KB
+	//varhandler:strict
+	PutNote(ctx context.Context, draft NoteDraft) (status int, err error)
+}
+
+// memNotes is a NoteAPI keeping notes in memory.
+type memNotes struct {
+	mu    sync.Mutex
+	notes map[NoteID]Note
+}
+
+func (m *memNotes) GetNote(ctx context.Context, id NoteID) (Note, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	note, ok := m.notes[id]
+	if !ok {
+		return note, ErrNoteNotFound
+	}
+	return note, nil
+}
+
+func (m *memNotes) PutNote(ctx context.Context, draft NoteDraft) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notes[draft.ID] = Note{ID: draft.ID, Text: draft.Text}
+	return http.StatusNoContent, nil
+}
@@ -0,0 +1,93 @@
+// Code generated by "varhandler -func ListUsers"; DO NOT EDIT
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/azr/generators/varhandler/varhttp"
+)
+
+func ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "ListUsers")
+	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	o.Start()
+	var param0 UserFilter
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if err = varhttp.SetInt(&param0.Limit, v); err != nil {
+			err = &varhttp.FieldError{Field: "Limit", In: "query", Name: "limit", Err: err}
+			o.Instantiated("UserFilter", err)
+			varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if v := r.URL.Query().Get("active"); v != "" {
+		if err = varhttp.SetBool(&param0.Active, v); err != nil {
+			err = &varhttp.FieldError{Field: "Active", In: "query", Name: "active", Err: err}
+			o.Instantiated("UserFilter", err)
+			varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if v := r.URL.Query().Get("since"); v != "" {
+		if err = param0.Since.UnmarshalText([]byte(v)); err != nil {
+			err = &varhttp.FieldError{Field: "Since", In: "query", Name: "since", Err: err}
+			o.Instantiated("UserFilter", err)
+			varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if v := r.Header.Get("X-Timeout"); v != "" {
+		if err = varhttp.SetDuration(&param0.Timeout, v); err != nil {
+			err = &varhttp.FieldError{Field: "Timeout", In: "header", Name: "X-Timeout", Err: err}
+			o.Instantiated("UserFilter", err)
+			varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if v := r.Header.Get("X-Request-Id"); v != "" {
+		if err = varhttp.SetString(&param0.RequestID, v); err != nil {
+			err = &varhttp.FieldError{Field: "RequestID", In: "header", Name: "X-Request-Id", Err: err}
+			o.Instantiated("UserFilter", err)
+			varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if v := varhttp.CookieValue(r, "session"); v != "" {
+		if err = varhttp.SetString(&param0.Session, v); err != nil {
+			err = &varhttp.FieldError{Field: "Session", In: "cookie", Name: "session", Err: err}
+			o.Instantiated("UserFilter", err)
+			varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	o.Instantiated("UserFilter", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	var resp []User
+
+	var status int
+
+	o.Start()
+	resp, status, err = ListUsers(param0)
+	o.Called(err)
+	if err != nil {
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	varhttp.EncodeResponse(w, r, "application/json", status, resp)
+
+}
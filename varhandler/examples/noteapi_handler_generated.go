@@ -0,0 +1,118 @@
+// Code generated by "varhandler -interface NoteAPI -output noteapi_handler_generated.go"; DO NOT EDIT
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/azr/generators/varhandler/varhttp"
+)
+
+// NoteAPIHandler is an http.Handler serving the methods of a NoteAPI,
+// each at the patterns of its //varhandler:route directives,
+// or at /<Method> when it has none.
+type NoteAPIHandler struct {
+	NoteAPI
+	mux *http.ServeMux
+}
+
+// NewNoteAPIHandler returns an http.Handler serving the methods of api.
+func NewNoteAPIHandler(api NoteAPI) *NoteAPIHandler {
+	s := &NoteAPIHandler{NoteAPI: api, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /notes/{id}", s.GetNoteHandler)
+	s.mux.HandleFunc("PUT /notes/{id}", s.PutNoteHandler)
+	return s
+}
+
+func (s *NoteAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *NoteAPIHandler) GetNoteHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "NoteAPIHandler.GetNote")
+	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	o.Start()
+	param0, err := HTTPNoteID(r)
+	if err != nil {
+		o.Instantiated("NoteID", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("NoteID", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	var resp Note
+
+	o.Start()
+	resp, err = s.GetNote(ctx, param0)
+	o.Called(err)
+	if err != nil {
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	varhttp.EncodeResponse(w, r, "application/json", 0, resp)
+
+}
+
+func (s *NoteAPIHandler) PutNoteHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "NoteAPIHandler.PutNote")
+	var err error
+	ctx := r.Context()
+	r.Body = http.MaxBytesReader(w, r.Body, 65536)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	o.Start()
+	var param0 NoteDraft
+	if v := r.PathValue("id"); v != "" {
+		if err = varhttp.SetString(&param0.ID, v); err != nil {
+			err = &varhttp.FieldError{Field: "ID", In: "path", Name: "id", Err: err}
+			o.Instantiated("NoteDraft", err)
+			varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if err = varhttp.DecodeStrictBody(r, "application/json", &param0.Text); err != nil {
+		err = &varhttp.FieldError{Field: "Text", In: "body", Name: "json", Err: err}
+		o.Instantiated("NoteDraft", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	o.Instantiated("NoteDraft", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	var status int
+
+	o.Start()
+	status, err = s.PutNote(ctx, param0)
+	o.Called(err)
+	if err != nil {
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if status != 0 {
+		w.WriteHeader(status)
+	}
+
+}
@@ -0,0 +1,111 @@
+// Code generated by "varhandler -func RenameUser,Login -output result_handlers_generated.go -register RegisterResultHandlers"; DO NOT EDIT
+
+package main
+
+import (
+	"net/http"
+
+	"github.com/azr/generators/varhandler/varhttp"
+)
+
+func RenameUserHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "RenameUser")
+	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	o.Start()
+	param0, err := HTTPUserID(r)
+	if err != nil {
+		o.Instantiated("UserID", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("UserID", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	o.Start()
+	param1, err := HTTPUserName(r)
+	if err != nil {
+		o.Instantiated("UserName", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("UserName", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	var resp User
+
+	var status ResultStatus
+
+	var header http.Header
+
+	o.Start()
+	status, resp, header, err = RenameUser(param0, param1)
+	o.Called(err)
+	if err != nil {
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	varhttp.CopyHeader(w, header)
+
+	varhttp.EncodeResponse(w, r, "application/json", int(status), resp)
+
+}
+
+func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "Login")
+	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	o.Start()
+	param0, err := HTTPUserName(r)
+	if err != nil {
+		o.Instantiated("UserName", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("UserName", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	var resp *LoginSession
+
+	o.Start()
+	resp, err = Login(param0)
+	o.Called(err)
+	if err != nil {
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	varhttp.EncodeResponse(w, r, "application/json", 0, resp)
+
+}
+
+// RegisterResultHandlers registers on mux the generated handlers, wrapped by
+// their middleware, with the patterns of their //varhandler:route directives.
+func RegisterResultHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("POST /users/{id}/rename", RenameUserHandler)
+	mux.HandleFunc("POST /login", LoginHandler)
+}
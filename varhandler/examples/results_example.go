@@ -0,0 +1,53 @@
+//go:generate varhandler -func RenameUser,Login -output result_handlers_generated.go -register RegisterResultHandlers
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+func init() {
+	RegisterResultHandlers(http.DefaultServeMux)
+}
+
+// ResultStatus is a status as a named type,
+// results are told apart by their type.
+type ResultStatus int
+
+type UserName string
+
+func HTTPUserName(r *http.Request) (UserName, error) {
+	name := UserName(r.URL.Query().Get("name"))
+	if name == "" {
+		return name, errors.New("Please provide a name")
+	}
+	return name, nil
+}
+
+// RenameUser renames a user, answering where it can be found.
+//varhandler:route POST /users/{id}/rename
+func RenameUser(id UserID, name UserName) (status ResultStatus, user User, header http.Header, err error) {
+	header = http.Header{}
+	header.Set("Location", "/users/"+string(id))
+	return http.StatusOK, User{Id: id, Name: string(name)}, header, nil
+}
+
+// LoginSession is a response setting a cookie and a header of its own.
+type LoginSession struct {
+	User  UserName `json:"user"`
+	Token string   `json:"-"`
+}
+
+func (s *LoginSession) Header() http.Header {
+	return http.Header{"Cache-Control": {"no-store"}}
+}
+
+func (s *LoginSession) Cookies() []*http.Cookie {
+	return []*http.Cookie{{Name: "session", Value: s.Token, HttpOnly: true}}
+}
+
+// Login opens a session for a user.
+//varhandler:route POST /login
+func Login(name UserName) (*LoginSession, error) {
+	return &LoginSession{User: name, Token: "t0k3n"}, nil
+}
@@ -2,32 +2,67 @@
 
 package main
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/azr/generators/varhandler/varhttp"
+)
 
 func SimpleHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "Simple")
 	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
 
+	o.Start()
 	param0, err := HTTPX(r)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		o.Instantiated("X", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("X", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
 		return
 	}
 
+	o.Start()
 	param1, err := HTTPY(r)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		o.Instantiated("Y", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("Y", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
 		return
 	}
 
+	o.Start()
 	param2, err := HTTPZ(r)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		o.Instantiated("*Z", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("*Z", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
 		return
 	}
 
+	o.Start()
 	err = Simple(param0, param1, param2)
+	o.Called(err)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
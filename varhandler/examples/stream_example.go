@@ -0,0 +1,70 @@
+//go:generate varhandler -func TailLog,WatchProgress,Followers -output stream_handlers_generated.go -register RegisterStreamHandlers
+package main
+
+import (
+	"context"
+	"io"
+	"iter"
+	"net/http"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterStreamHandlers(http.DefaultServeMux)
+}
+
+type LogName string
+
+func HTTPLogName(r *http.Request) (LogName, error) {
+	return LogName(r.PathValue("name")), nil
+}
+
+type JobID string
+
+func HTTPJobID(r *http.Request) (JobID, error) {
+	return JobID(r.PathValue("id")), nil
+}
+
+// TailLog streams a log as it is read, flushed after each read.
+//varhandler:route GET /logs/{name}
+func TailLog(name LogName) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader("started " + string(name) + "\nstopped\n")), nil
+}
+
+type Step struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// WatchProgress sends the steps of a job, as NDJSON,
+// or as Server-Sent Events for a client accepting text/event-stream.
+// The channel is left once the request is done.
+//varhandler:route GET /jobs/{id}/progress
+func WatchProgress(ctx context.Context, id JobID) (<-chan Step, error) {
+	steps := make(chan Step)
+	go func() {
+		defer close(steps)
+		for i := 1; i <= 3; i++ {
+			select {
+			case steps <- Step{Done: i, Total: 3}:
+			case <-ctx.Done():
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	return steps, nil
+}
+
+// Followers yields the followers of a user, one line each.
+//varhandler:route GET /users/{id}/followers
+func Followers(id UserID) (iter.Seq[User], error) {
+	return func(yield func(User) bool) {
+		for _, follower := range []UserID{"2", "3"} {
+			if !yield(User{Id: follower}) {
+				return
+			}
+		}
+	}, nil
+}
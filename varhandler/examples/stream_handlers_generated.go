@@ -0,0 +1,133 @@
+// Code generated by "varhandler -func TailLog,WatchProgress,Followers -output stream_handlers_generated.go -register RegisterStreamHandlers"; DO NOT EDIT
+
+package main
+
+import (
+	"io"
+	"iter"
+	"net/http"
+
+	"github.com/azr/generators/varhandler/varhttp"
+)
+
+func TailLogHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "TailLog")
+	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	o.Start()
+	param0, err := HTTPLogName(r)
+	if err != nil {
+		o.Instantiated("LogName", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("LogName", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	var resp io.ReadCloser
+
+	o.Start()
+	resp, err = TailLog(param0)
+	o.Called(err)
+	if err != nil {
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	varhttp.EncodeResponse(w, r, "application/json", 0, resp)
+
+}
+
+func WatchProgressHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "WatchProgress")
+	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	o.Start()
+	param0, err := HTTPJobID(r)
+	if err != nil {
+		o.Instantiated("JobID", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("JobID", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	var resp <-chan Step
+
+	o.Start()
+	resp, err = WatchProgress(ctx, param0)
+	o.Called(err)
+	if err != nil {
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	varhttp.EncodeResponse(w, r, "application/json", 0, resp)
+
+}
+
+func FollowersHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "Followers")
+	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	o.Start()
+	param0, err := HTTPUserID(r)
+	if err != nil {
+		o.Instantiated("UserID", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("UserID", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	var resp iter.Seq[User]
+
+	o.Start()
+	resp, err = Followers(param0)
+	o.Called(err)
+	if err != nil {
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	varhttp.EncodeResponse(w, r, "application/json", 0, resp)
+
+}
+
+// RegisterStreamHandlers registers on mux the generated handlers, wrapped by
+// their middleware, with the patterns of their //varhandler:route directives.
+func RegisterStreamHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("GET /logs/{name}", TailLogHandler)
+	mux.HandleFunc("GET /jobs/{id}/progress", WatchProgressHandler)
+	mux.HandleFunc("GET /users/{id}/followers", FollowersHandler)
+}
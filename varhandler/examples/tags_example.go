@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// UserFilter has no HTTPUserFilter instantiator:
+// one is generated from its struct tags.
+type UserFilter struct {
+	Limit     int           `query:"limit"`
+	Active    bool          `query:"active"`
+	Since     time.Time     `query:"since"`
+	Timeout   time.Duration `header:"X-Timeout"`
+	RequestID string        `header:"X-Request-Id"`
+	Session   string        `cookie:"session"`
+}
+
+//go:generate varhandler -func ListUsers
+func ListUsers(f UserFilter) (users []User, status int, err error) {
+	if f.Limit < 0 {
+		return nil, http.StatusBadRequest, nil
+	}
+	return []User{{Id: "1", Name: "gopher"}}, http.StatusOK, nil
+}
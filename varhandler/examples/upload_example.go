@@ -0,0 +1,56 @@
+//go:generate varhandler -func UploadAvatar,UploadDocuments -output upload_handlers_generated.go -register RegisterUploadHandlers
+package main
+
+import (
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/azr/generators/varhandler/varhttp"
+)
+
+func init() {
+	// keep up to 1MB of an upload in memory, the rest goes to temporary files
+	varhttp.MultipartMaxMemory = 1 << 20
+	RegisterUploadHandlers(http.DefaultServeMux)
+}
+
+// UploadAvatar reads the file of the avatar field of a multipart form,
+// closed once the handler returns.
+//varhandler:route PUT /users/{id}/avatar
+func UploadAvatar(id UserID, avatar io.Reader) (status int, err error) {
+	if _, err := io.Copy(io.Discard, avatar); err != nil {
+		return 0, err
+	}
+	return http.StatusNoContent, nil
+}
+
+// Documents is an upload of documents: a title, an optional cover
+// and pages.
+type Documents struct {
+	Owner UserID                  `path:"id"`
+	Title string                  `form:"title"`
+	Cover *multipart.FileHeader   `file:"cover"`
+	Pages []*multipart.FileHeader `file:"pages"`
+}
+
+type Receipt struct {
+	Title string   `json:"title"`
+	Files []string `json:"files"`
+	Size  int64    `json:"size"`
+}
+
+// UploadDocuments takes the documents of a user.
+//varhandler:route POST /users/{id}/documents
+func UploadDocuments(docs Documents) (Receipt, error) {
+	receipt := Receipt{Title: docs.Title}
+	files := docs.Pages
+	if docs.Cover != nil {
+		files = append([]*multipart.FileHeader{docs.Cover}, files...)
+	}
+	for _, fh := range files {
+		receipt.Files = append(receipt.Files, fh.Filename)
+		receipt.Size += fh.Size
+	}
+	return receipt, nil
+}
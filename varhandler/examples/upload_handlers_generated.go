@@ -0,0 +1,147 @@
+// Code generated by "varhandler -func UploadAvatar,UploadDocuments -output upload_handlers_generated.go -register RegisterUploadHandlers"; DO NOT EDIT
+
+package main
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/azr/generators/varhandler/varhttp"
+)
+
+func UploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "UploadAvatar")
+	var err error
+	ctx := r.Context()
+	defer varhttp.RemoveMultipartForm(r)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	o.Start()
+	param0, err := HTTPUserID(r)
+	if err != nil {
+		o.Instantiated("UserID", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("UserID", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	o.Start()
+	var param1 io.Reader
+	if err = varhttp.ParseMultipartForm(r); err != nil {
+		o.Instantiated("io.Reader", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err = varhttp.OpenFormFile(r, "avatar", &param1); err != nil {
+		err = &varhttp.FieldError{Field: "", In: "file", Name: "avatar", Err: err}
+		o.Instantiated("io.Reader", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	defer varhttp.CloseFormFile(param1)
+
+	o.Instantiated("io.Reader", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	var status int
+
+	o.Start()
+	status, err = UploadAvatar(param0, param1)
+	o.Called(err)
+	if err != nil {
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if status != 0 {
+		w.WriteHeader(status)
+	}
+
+}
+
+func UploadDocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "UploadDocuments")
+	var err error
+	ctx := r.Context()
+	defer varhttp.RemoveMultipartForm(r)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	o.Start()
+	var param0 Documents
+	if err = varhttp.ParseMultipartForm(r); err != nil {
+		o.Instantiated("Documents", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if v := r.PathValue("id"); v != "" {
+		if err = varhttp.SetString(&param0.Owner, v); err != nil {
+			err = &varhttp.FieldError{Field: "Owner", In: "path", Name: "id", Err: err}
+			o.Instantiated("Documents", err)
+			varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if v := r.FormValue("title"); v != "" {
+		if err = varhttp.SetString(&param0.Title, v); err != nil {
+			err = &varhttp.FieldError{Field: "Title", In: "form", Name: "title", Err: err}
+			o.Instantiated("Documents", err)
+			varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if err = varhttp.SetFormFile(r, "cover", &param0.Cover); err != nil && err != http.ErrMissingFile {
+		err = &varhttp.FieldError{Field: "Cover", In: "file", Name: "cover", Err: err}
+		o.Instantiated("Documents", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err = varhttp.SetFormFiles(r, "pages", &param0.Pages); err != nil && err != http.ErrMissingFile {
+		err = &varhttp.FieldError{Field: "Pages", In: "file", Name: "pages", Err: err}
+		o.Instantiated("Documents", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	o.Instantiated("Documents", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	var resp Receipt
+
+	o.Start()
+	resp, err = UploadDocuments(param0)
+	o.Called(err)
+	if err != nil {
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	varhttp.EncodeResponse(w, r, "application/json", 0, resp)
+
+}
+
+// RegisterUploadHandlers registers on mux the generated handlers, wrapped by
+// their middleware, with the patterns of their //varhandler:route directives.
+func RegisterUploadHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("PUT /users/{id}/avatar", UploadAvatarHandler)
+	mux.HandleFunc("POST /users/{id}/documents", UploadDocumentsHandler)
+}
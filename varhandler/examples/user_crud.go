@@ -1,18 +1,21 @@
-//go:generate varhandler -func CreateUser,GetUser,UpdateUser,DeleteUser -output user_handlers_generated.go
+//go:generate varhandler -func CreateUser,GetUser,GetUserCard,UpdateUser,DeleteUser -output user_handlers_generated.go -openapi openapi.json -client client_generated.go
 package main
 
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
+
+	"github.com/azr/generators/varhandler/varhttp"
 )
 
+var ErrUserNotFound = errors.New("user not found")
+
 func init() {
-	http.HandleFunc("/user/create", CreateUserHandler)
-	http.HandleFunc("/user/get", GetUserHandler)
-	http.HandleFunc("/user/update", UpdateUserHandler)
-	http.HandleFunc("/user/delete", DeleteUserHandler)
+	varhttp.RegisterErrorStatus(ErrUserNotFound, http.StatusNotFound)
+	RegisterHandlers(http.DefaultServeMux)
 }
 
 ///////
@@ -29,14 +32,23 @@ type User struct {
 func HTTPUser(r *http.Request) (u User, err error) {
 	// if request encoding is json :
 	err = json.NewDecoder(r.Body).Decode(&u)
+	return
+}
+
+// Validate is called by the handlers once the user is decoded,
+// a failure is answered with a 422.
+func (u User) Validate() error {
 	if u.Name == "" {
-		return u, errors.New("EmptyName")
+		return &varhttp.FieldError{Field: "Name", Err: errors.New("is empty")}
 	}
-	return
+	return nil
 }
 
 func (u User) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// if response encoding has to be json :
+	// headers can be set after the status the func returned,
+	// it is written once the body starts.
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(u)
 }
 
@@ -44,7 +56,7 @@ func (u User) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 type UserID string
 
 func HTTPUserID(r *http.Request) (uid UserID, err error) {
-	uid = UserID(r.URL.Query().Get("user_id"))
+	uid = UserID(r.PathValue("id"))
 	if uid == "" {
 		return uid, errors.New("Please provide a user id")
 	}
@@ -58,6 +70,7 @@ func HTTPUserID(r *http.Request) (uid UserID, err error) {
 
 //create
 
+//varhandler:route POST /users
 func CreateUser(user User) (status int, err error) {
 	//save user into database
 	return http.StatusCreated, err
@@ -69,6 +82,7 @@ func CreateUser(user User) (status int, err error) {
 
 //get
 
+//varhandler:route GET /users/{id}
 func GetUser(id UserID) (resp http.Handler, status int, err error) {
 	if id == "404" { // check case
 		return nil, http.StatusNotFound, nil
@@ -80,8 +94,25 @@ func GetUser(id UserID) (resp http.Handler, status int, err error) {
 	return user, http.StatusOK, err
 }
 
+//card
+
+// UserCard is the public view of a user, printed as its name.
+type UserCard struct {
+	Id   UserID `json:"id"`
+	Name string `json:"name"`
+}
+
+func (c UserCard) String() string { return c.Name }
+
+//varhandler:route GET /users/{id}/card
+func GetUserCard(id UserID) (UserCard, error) {
+	return UserCard{Id: id, Name: "gopher"}, nil
+}
+
 //update
 
+//varhandler:route PUT /users/{id}
+//varhandler:maxbody 1MB
 func UpdateUser(id UserID, user User) (status int, err error) {
 	//user might have to be
 	//a UserUpdateRequest type
@@ -102,9 +133,22 @@ func UpdateUser(id UserID, user User) (status int, err error) {
 
 //delete
 
+// RequireAdmin only lets admins through.
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Admin") == "" {
+			varhttp.WriteProblem(w, r, http.StatusForbidden, "admins only")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+//varhandler:route DELETE /users/{id}
+//varhandler:middleware RequireAdmin
 func DeleteUser(id UserID) (status int, err error) {
 	if id == "404" { // check case
-		return http.StatusNotFound, nil
+		return 0, fmt.Errorf("deleting %s: %w", id, ErrUserNotFound)
 	}
 	//db.DeleteUser(id)
 	if err != nil {
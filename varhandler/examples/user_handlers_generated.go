@@ -1,23 +1,50 @@
-// Code generated by "varhandler -func CreateUser,GetUser,UpdateUser,DeleteUser -output user_handlers_generated.go"; DO NOT EDIT
+// Code generated by "varhandler -func CreateUser,GetUser,GetUserCard,UpdateUser,DeleteUser -output user_handlers_generated.go -openapi openapi.json -client client_generated.go"; DO NOT EDIT
 
 package main
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/azr/generators/varhandler/varhttp"
+)
 
 func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "CreateUser")
 	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
 
+	o.Start()
 	param0, err := HTTPUser(r)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		o.Instantiated("User", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err = param0.Validate(); err != nil {
+		err = &varhttp.ValidationError{Err: err}
+		o.Instantiated("User", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusUnprocessableEntity, err)
+		return
+	}
+	o.Instantiated("User", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
 		return
 	}
 
 	var status int
 
+	o.Start()
 	status, err = CreateUser(param0)
+	o.Called(err)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -28,54 +55,134 @@ func CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "GetUser")
 	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
 
+	o.Start()
 	param0, err := HTTPUserID(r)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		o.Instantiated("UserID", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("UserID", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
 		return
 	}
 
-	var resp interface{}
+	var resp http.Handler
 
 	var status int
 
+	o.Start()
 	resp, status, err = GetUser(param0)
+	o.Called(err)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
-	if status != 0 {
-		w.WriteHeader(status)
+	varhttp.EncodeResponse(w, r, "application/json", status, resp)
+
+}
+
+func GetUserCardHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "GetUserCard")
+	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
 	}
 
-	if resp != nil {
-		HandleHTTPResponse(w, r, resp)
+	o.Start()
+	param0, err := HTTPUserID(r)
+	if err != nil {
+		o.Instantiated("UserID", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("UserID", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
+
+	var resp UserCard
+
+	o.Start()
+	resp, err = GetUserCard(param0)
+	o.Called(err)
+	if err != nil {
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		return
 	}
 
+	varhttp.EncodeResponse(w, r, "application/json", 0, resp)
+
 }
 
 func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "UpdateUser")
 	var err error
+	ctx := r.Context()
+	r.Body = http.MaxBytesReader(w, r.Body, 1048576)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
 
+	o.Start()
 	param0, err := HTTPUserID(r)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		o.Instantiated("UserID", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("UserID", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
 		return
 	}
 
+	o.Start()
 	param1, err := HTTPUser(r)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		o.Instantiated("User", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err = param1.Validate(); err != nil {
+		err = &varhttp.ValidationError{Err: err}
+		o.Instantiated("User", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusUnprocessableEntity, err)
+		return
+	}
+	o.Instantiated("User", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
 		return
 	}
 
 	var status int
 
+	o.Start()
 	status, err = UpdateUser(param0, param1)
+	o.Called(err)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -86,19 +193,36 @@ func UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	w = varhttp.NewResponseWriter(w)
+	defer varhttp.Recover(w, r)
+	o := varhttp.Observe(w, r, "DeleteUser")
 	var err error
+	ctx := r.Context()
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
+		return
+	}
 
+	o.Start()
 	param0, err := HTTPUserID(r)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		o.Instantiated("UserID", err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		return
+	}
+	o.Instantiated("UserID", nil)
+	if err = ctx.Err(); err != nil {
+		varhttp.HandleContextError(w, r, err) // client is gone
 		return
 	}
 
 	var status int
 
+	o.Start()
 	status, err = DeleteUser(param0)
+	o.Called(err)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		varhttp.HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -107,3 +231,13 @@ func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 }
+
+// RegisterHandlers registers on mux the generated handlers, wrapped by
+// their middleware, with the patterns of their //varhandler:route directives.
+func RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("POST /users", CreateUserHandler)
+	mux.HandleFunc("GET /users/{id}", GetUserHandler)
+	mux.HandleFunc("GET /users/{id}/card", GetUserCardHandler)
+	mux.HandleFunc("PUT /users/{id}", UpdateUserHandler)
+	mux.Handle("DELETE /users/{id}", RequireAdmin(http.HandlerFunc(DeleteUserHandler)))
+}
@@ -35,24 +35,333 @@
 //
 //  func F(x X, y Y) (response interface{}, status int, err error) // sets status and does Response Handling if no error is set
 //
+// Results are told apart by their type, in any order before the error:
+// the status is an int or a named integer type, like
+//  type Status int
+// and an http.Header result is copied to the response before its status:
+//  func F(x X) (Status, User, http.Header, error)
+// A func returning two statuses, two responses or an error before the
+// last result is reported with the position of the offending result.
+//
+// A response with a Header() http.Header or a Cookies() []*http.Cookie
+// method sets its headers and cookies, like a Location after a create or
+// a session cookie, before the status is written:
+//  func (s *Session) Cookies() []*http.Cookie
+//  func Login(name UserName) (*Session, error)
+// See CopyResponseHeader. Such a method on the pointer of a response
+// returned by value is reported at generation.
+//
+// The response can have any type, like User or *User: an http.Handler,
+// Byter, Stringer or []byte is written by HandleHTTPResponse, anything
+// else is encoded with a codec, json unless told otherwise by -codec
+// or for a func by a directive:
+//  //varhandler:codec xml
+//  func GetUser(id UserID) (User, error)
+//
+// Codecs are json, xml and gob. Responses the codec can't encode,
+// like a map in xml or a func, are reported at generation.
+//
+// Streaming
+//
+// An io.Reader or io.ReadCloser response is streamed as it is read,
+// flushed after each read, and closed. A <-chan T or an iter.Seq[T]
+// response is streamed one value at a time, flushed after each, in json:
+// one per line as application/x-ndjson, or as the events of a
+// text/event-stream when the request accepts it better, a 406 when it
+// accepts neither:
+//  func TailLog(name LogName) (io.ReadCloser, error)
+//  func WatchProgress(ctx context.Context, id JobID) (<-chan Step, error)
+//  func Followers(id UserID) (iter.Seq[User], error)
+// The stream stops when the channel is closed, the sequence ends or the
+// request is done, a nil channel or sequence is empty. The status and
+// headers are sent with the first bytes of a reader, before the first
+// value of a channel or sequence: an error before is answered, an error
+// after aborts the response. See Stream. The client returns the []T of a
+// stream, the []byte of a reader.
+//
+// Content negotiation
+//
+// Responses are written in the format the request accepts, from
+// the Codecs registry of the helpers, keyed by media type: application/json,
+// application/xml, application/x-gob, text/plain (Stringer) and
+// application/octet-stream (Byter, []byte). The Accept header and its
+// q-values pick the codec and the Content-Type it sets. The codec of the
+// func is preferred when more than one is accepted as much; when none
+// of the accepted codecs encodes the response, a 406 is answered.
+//
+// Bodies are only decoded in the format of their body tag, by the
+// Decoders registry, apart from Codecs: adding a response format never
+// widens what the server parses. A request with another Content-Type
+// is answered with a 415.
+//
 // Variing parameters
 //
 // The functions takes one or more arguments.
 // Those arguments need to have http instantiators
 //  HTTPX(r *http.Request) (x X, err error)
 //
+// Params are resolved by the type checker, so any type can be used:
+// X, *X, []X, map[K]V, *pkg.X, generic instantiations or aliases.
+// The instantiator of a param is the HTTP prefixed func returning its
+// exact type, searched in the package being generated, then in the package
+// declaring the named type. If more than one matches, HTTPX wins for X or *X.
+//
+// Pkgs of instantiators are imported by path, once for all the funcs,
+// under the alias of the import used to declare the func: aliased and dot
+// imports are kept.
+//
+// Instantiators can take params too, after the request:
+//  HTTPAccount(r *http.Request, uid UserID) (Account, error)
+//
+// They are instantiated first, in topological order, and each instantiator
+// is called once per request: a func taking a UserID and an Account gets
+// the UserID HTTPAccount got. Cycles and params without instantiator are
+// reported at generation, and fail it: once every func that can't be
+// generated is reported, varhandler exits with status 1 and writes no
+// file, so that go generate stops at the cause rather than at the build
+// of handlers missing a func.
+//
+// Generated instantiators
+//
+// When a struct param has no instantiator, one is generated
+// from the tags of its fields:
+//  type UserFilter struct {
+//      ID      UserID        `path:"id"`          // r.PathValue("id")
+//      Limit   int           `query:"limit"`      // r.URL.Query().Get("limit")
+//      Request string        `header:"X-Req-Id"`  // r.Header.Get("X-Req-Id")
+//      Session string        `cookie:"session"`   // value of the session cookie
+//      Name    string        `form:"name"`        // r.FormValue("name")
+//      Since   time.Time     `query:"since"`      // any encoding.TextUnmarshaler
+//      Timeout time.Duration `query:"timeout"`
+//      Body    Payload       `body:"json"`        // decoded body, json, xml or gob
+//  }
+//
+// Values are converted to the type of their field: strings, ints,
+// uints, floats, bools, time.Duration or any encoding.TextUnmarshaler
+// like time.Time. Empty values are left unset.
+// A value that can't be converted is answered with a *FieldError
+// telling which value is wrong, with a http.StatusBadRequest.
+//
+// Uploads
+//
+// Files of a multipart form are read by the file tag, into a
+// *multipart.FileHeader, a []*multipart.FileHeader or an io.Reader
+// opened on the file, and closed once the handler returns:
+//  type Documents struct {
+//      Title string                  `form:"title"`
+//      Cover *multipart.FileHeader   `file:"cover"`
+//      Pages []*multipart.FileHeader `file:"pages"`
+//  }
+// A missing file leaves its field unset. A param of one of these types,
+// with no instantiator, is the file of the form field named after it,
+// answered with a 400 when it's missing:
+//  func UploadAvatar(id UserID, avatar io.Reader) (status int, err error)
+//
+// The form is parsed with ParseMultipartForm, keeping up to
+// MultipartMaxMemory of it in memory, 32MB unless set otherwise, and
+// its temporary files are removed once the handler returns.
+//
+// Request bodies
+//
+// The body of the requests of a func is limited in size with
+// http.MaxBytesReader, for every instantiator, by a directive taking a
+// size in B, KB, MB or GB, powers of 1024:
+//  //varhandler:maxbody 1MB
+//  func UpdateUser(id UserID, user User) (status int, err error)
+// A larger body is answered with a 413 Problem.
+//
+// Generated json decoders of body tags are strict with:
+//  //varhandler:strict
+// an unknown field or data after the value is answered with a 400.
+// Only json bodies can be strict: a strict func with an xml or gob body
+// tag is reported at generation, so that strictness is never skipped.
+// Hand written instantiators can use DecodeStrictBody.
+//
+// Validation
+//
+// Once instantiated, a param with a method
+//  Validate() error
+//  Validate(ctx context.Context) error
+// is validated, so that instantiators only decode. A failure is answered
+// with a http.StatusUnprocessableEntity, as a *ValidationError: its Problem
+// lists the *FieldError the error is made of, with errors.Join for more
+// than one, in invalid-params.
+//  func (u User) Validate() error {
+//      if u.Name == "" {
+//          return &FieldError{Field: "Name", Err: errors.New("is empty")}
+//      }
+//      return nil
+//  }
+//
+// Routes
+//
+// A func can declare the http.ServeMux patterns (Go 1.22) of its handler:
+//  //varhandler:route GET /users/{id}
+//  func GetUser(id UserID) (resp interface{}, err error)
+//
+// The generated file then has a func registering every such handler:
+//  func RegisterHandlers(mux *http.ServeMux) {
+//      mux.HandleFunc("GET /users/{id}", GetUserHandler)
+//  }
+//
+// Its name can be changed with the -register flag, to generate
+// more than one file per package. Wildcards of the route are read
+// by instantiators with r.PathValue, or with a `path:"id"` tag.
+// Invalid or conflicting patterns are reported at generation.
+//
+// Middleware
+//
+// Handlers are registered wrapped by the func(http.Handler) http.Handler
+// of their directives, the first one outermost:
+//  //varhandler:route DELETE /users/{id}
+//  //varhandler:middleware RequireAuth,RateLimit
+//  func DeleteUser(id UserID) (status int, err error)
+//
+// gives
+//  mux.Handle("DELETE /users/{id}", RequireAuth(RateLimit(http.HandlerFunc(DeleteUserHandler))))
+//
+// -middleware sets the default chain of the package, wrapping every
+// handler before the middleware of its func. Middleware are funcs or vars
+// of the package, pkg.Name of an imported one, or methods of the receiver.
+//
+// Services
+//
+// Funcs can be methods of a service struct holding their dependencies,
+// named with their receiver, or with -receiver for all of them:
+//  varhandler -func '(*UserService).GetUser'
+//  varhandler -receiver UserService -func GetUser,DeleteUser
+//  varhandler -receiver UserService // every method with a route
+//
+// Their handlers are methods of the same receiver, always a pointer:
+//  func (s *UserService) GetUserHandler(w http.ResponseWriter, r *http.Request)
+//
+// and so are instantiators: HTTP prefixed methods of the receiver
+// are searched before funcs, and can only be used by its methods.
+// Instead of a RegisterHandlers func, the receiver gets a Routes
+// method returning its routed handlers:
+//  HandleRoutes(mux, s.Routes())
+//
+// Interfaces
+//
+// With -interface UserAPI, an http.Handler adapter is generated for the
+// methods of an interface of the package, taking any implementation:
+//  http.Handle("/users/", NewUserAPIHandler(impl))
+//
+// Each method is served at the patterns of its //varhandler:route
+// directives, written in its doc in the interface, or at /<Method>.
+// Its params use the instantiators of funcs, and its handler is
+// a method of UserAPIHandler, which embeds the UserAPI.
+//
+// Contexts
+//
+// If the first param of the function is a context.Context,
+// the request's context r.Context() is passed.
+// Instantiators can take the context too:
+//  HTTPX(ctx context.Context, r *http.Request) (x X, err error)
+//
+// The handler returns early, without calling the first or the next
+// instantiator or the function, once the context is done: the client
+// is gone. The
+// context error is handled, with a 499 when the request is cancelled
+// or a 503 past its deadline, see HandleContextError.
+//
+// OpenAPI
+//
+// With -openapi openapi.json, an OpenAPI 3.1 document of the funcs
+// that have a route is written too. The first line of the doc of a func
+// is the summary of its operation, named after the func. Two routes
+// documented as the same operation, like a path on two hosts, fail the
+// generation.
+// Parameters and request bodies come from the tags of generated
+// instantiators, or from what hand written ones read:
+//  r.PathValue("id"), r.URL.Query().Get("limit"), r.Header.Get("X-Req-Id"),
+//  r.Cookie("session"), r.FormValue("name"),
+//  json.NewDecoder(r.Body).Decode(&x) // or xml
+//
+// Bodies are described as encoding/json encodes them.
+// The response is described with the media type of its codec,
+// or when HandleHTTPResponse can tell its content from its type,
+// along with the error statuses of instantiators and the 500 of the func.
+//
+// Client
+//
+// With -client client_generated.go, a Client calling the funcs
+// that have a route over http is generated in the package:
+//  c := &Client{BaseURL: "http://localhost:8080"}
+//  resp, status, err := c.GetUser(ctx, id)
+//
+// Its methods take the params of the funcs and set them where the
+// instantiators read them: tagged fields, or the single value
+// a hand written instantiator reads. A param made only of the params its
+// instantiator takes is replaced by them. Params read otherwise need a method
+//  EncodeHTTP(r *http.Request) error
+//
+// The request accepts the media type of the codec of the func, or
+// application/x-ndjson for a stream, so that a fmt.Stringer response
+// isn't answered as text/plain. The response is decoded into the
+// response type of the func according to its Content-Type, into a
+// []byte for an interface. Responses with a status of 400 or more are returned as a *StatusError.
+//
+// Helpers
+//
+// Generated code calls helpers, like HandleHTTPErrorWithDefaultStatus,
+// of the runtime pkg github.com/azr/generators/varhandler/varhttp,
+// versioned with the github.com/azr/generators module, which requires
+// Go 1.23. With -helpers=copy, they are written into the package being
+// generated instead, with its name, in varhandler_helpers.go: they
+// declare dozens of names, like ResponseWriter, Problem or Client, and
+// one the package declares already fails the generation. The helpers
+// are embedded in the varhandler binary, its source tree is not needed.
+//
 // Error handling
 //
 // If an instantiation error occurs:
 //  HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err) // will be called
 //
+// unless the instantiator has a default status of its own, like an
+// authentication instantiator:
+//  //varhandler:status 401
+//  func HTTPToken(r *http.Request) (Token, error)
+//
 // If the wrapped func returns an error
 //  HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err) // will be called
 //
+// Errors are matched with errors.As, so wrapped errors are handled too:
+// an HTTPError answers with its status, and so does an error with a method
+//  StatusCode() int
+// Sentinel errors can be given a status:
+//  RegisterErrorStatus(ErrUserNotFound, http.StatusNotFound) // matched with errors.Is
+//
+// Other errors are answered with the default status. Error responses are
+// RFC 9457 problems, application/problem+json, with a type, title, status,
+// detail and instance. The detail of a 500 or more is left out, not to
+// show internal errors to clients.
+//
 // Response handling
 //
 // check HandleHTTPResponse's code
 //
+// Handlers write into a *ResponseWriter deferring the status until the
+// body starts, so that an http.Handler response can set headers after
+// the status the func returned. A panic is recovered: it is passed with
+// its stack to the LogPanic hook and answered as a 500, unless the body
+// had started already, in which case the connection is aborted.
+//  LogPanic = func(r *http.Request, err *PanicError) { ... }
+//
+// Observers
+//
+// Handlers tell the HandlerObserver, when set, about their stages, for
+// metrics or tracing: the time taken to instantiate each param, to call
+// the func and to write the response, with its status, and every error
+// answered. A param that can't be instantiated, bound or validated ends
+// its stage with the error answered.
+//  type Observer interface {
+//      OnInstantiate(r *http.Request, handler, param string, d time.Duration, err error)
+//      OnCall(r *http.Request, handler string, d time.Duration, err error)
+//      OnResponse(r *http.Request, handler string, status int, d time.Duration)
+//      OnError(r *http.Request, handler string, err error)
+//  }
+//
 // Example
 //
 // Old way :
@@ -108,6 +417,8 @@
 // In that case generated code looks like :
 //
 //   func FHandler(w http.ResponseWriter, r *http.Request) {
+//       w = NewResponseWriter(w)
+//       defer Recover(w, r)
 //       var err error
 //       x, err := HTTPX(r)
 //       if err != nil {
@@ -134,55 +445,26 @@
 //          HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
 //          return
 //       }
-//       if status != 0 { // code generated if status is returned by F
-//          w.WriteHeader(status)
-//       }
-//       if resp != nil { // code generated if resp object is returned by F
-//          HandleHTTPResponse(w, r, resp)
-//       }
+//       EncodeResponse(w, r, "json", status, resp) // code generated if resp object is returned by F
+//                                                  // writes status, then resp, see HandleHTTPResponse
 //   }
 //
 //   //Helper funcs
 //
 //   func HandleHTTPErrorWithDefaultStatus(w http.ResponseWriter, r *http.Request, status int, err error) {
-//       type HttpError interface {
-//          HttpError() (error string, code int)
-//       }
-//       type SelfHttpError interface {
-//          HttpError(w http.ResponseWriter)
-//       }
-//       switch t := err.(type) {
+//       var httpError interface{ HTTPError() (error string, code int) }
+//       switch {
+//       case errors.As(err, &httpError):
+//          detail, code := httpError.HTTPError()
+//          WriteProblem(w, r, code, detail)
+//       ... // http.Handler, SelfHTTPError, then RegisterErrorStatus-ed errors
 //       default:
-//          w.WriteHeader(status)
-//       case HttpError:
-//          err, code := t.HttpError()
-//          http.Error(w, err, code)
-//       case http.Handler:
-//          t.ServeHTTP(w, r)
-//       case SelfHttpError:
-//          t.HttpError(w)
+//          WriteProblem(w, r, status, detail) // no detail for a 500
 //       }
 //   }
 //
 //   func HandleHTTPResponse(w http.ResponseWriter, r *http.Request, resp interface{}) {
-//       type Byter interface {
-//          Bytes() []byte
-//       }
-//       type Stringer interface {
-//          String() string
-//       }
-//       switch t := resp.(type) {
-//       default:
-//          // I don't know that type !
-//       case http.Handler:
-//          t.ServeHTTP(w, r) // resp knows how to handle itself
-//       case Byter:
-//          w.Write(t.Bytes())
-//       case Stringer:
-//          w.Write([]byte(t.String()))
-//       case []byte:
-//          w.Write(t)
-//       }
+//       EncodeResponse(w, r, "", 0, resp) // ServeHTTP, or the codec r accepts
 //   }
 //
 package main // import "github.com/azr/generators/varhandler"
@@ -192,20 +474,19 @@ import (
 	"flag"
 	"fmt"
 	"go/ast"
-	"go/build"
 	"go/format"
-	"go/importer"
-	"go/parser"
 	"go/token"
 	"go/types"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
-	"runtime"
+	"regexp"
 	"strings"
 	"text/template"
 
+	"github.com/azr/generators/loader"
 	"github.com/azr/generators/utils"
 )
 
@@ -214,6 +495,8 @@ func Usage() {
 	fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "\tvarhandler [flags] -func F [directory]\n")
 	fmt.Fprintf(os.Stderr, "\tvarhandler [flags] -func F files... # Must be a single package\n")
+	fmt.Fprintf(os.Stderr, "\tvarhandler [flags] -receiver T [directory]\n")
+	fmt.Fprintf(os.Stderr, "\tvarhandler [flags] -interface I [directory]\n")
 	fmt.Fprintf(os.Stderr, "For more information, see:\n")
 	fmt.Fprintf(os.Stderr, "\thttp://godoc.org/github.com/azr/generators/varhandler\n")
 	fmt.Fprintf(os.Stderr, "Flags:\n")
@@ -226,20 +509,35 @@ func main() {
 		log.SetPrefix("handler: ")
 	}
 
-	var funcNames, output string
+	var funcNames, receiver, iface, middleware, output, register, openapi, client, codec, helpers string
 	{ // init
-		flag.StringVar(&funcNames, "func", "", "comma-separated list of func names; must be set")
+		flag.StringVar(&funcNames, "func", "", "comma-separated list of func names, or methods like (*T).Method; must be set unless -receiver is")
+		flag.StringVar(&receiver, "receiver", "", "type the funcs of -func are methods of;\n\tdefault for -func: the methods of the type that have a //varhandler:route")
+		flag.StringVar(&iface, "interface", "", "interface to generate an http.Handler adapter for, serving each of its methods;\n\tcannot be used with -func or -receiver")
+		flag.StringVar(&middleware, "middleware", "", "comma-separated list of the func(http.Handler) http.Handler wrapping every handler\n\tregistered, before the ones of a //varhandler:middleware")
 		flag.StringVar(&output, "output", "", "output file name;\n\tdefault for multiple funcs: pkgdir/generated_varhandlers.go\n\tdefault for one func: pkgdir/<toLower(funcName)>_handler_generated.go")
+		flag.StringVar(&register, "register", "RegisterHandlers", "name of the generated func registering the handlers that have a //varhandler:route on a *http.ServeMux")
+		flag.StringVar(&openapi, "openapi", "", "file to write the OpenAPI document of the handlers that have a //varhandler:route to, like openapi.json")
+		flag.StringVar(&client, "client", "", "file to write a Client calling the handlers that have a //varhandler:route to, like client_generated.go")
+		flag.StringVar(&codec, "codec", "json", "codec of the responses HandleHTTPResponse can't write, one of "+strings.Join(codecs, ", ")+"; set for a func with //varhandler:codec")
+		flag.StringVar(&helpers, "helpers", "import", "copy: write the helpers into the package, in "+helpersFile+";\n\timport: use the ones of "+runtimePath)
 		flag.Usage = Usage
 		flag.Parse()
 	}
 
-	if len(funcNames) == 0 {
+	if len(funcNames) == 0 && receiver == "" && iface == "" {
 		flag.Usage()
 		os.Exit(2)
 	}
-
-	funcs := strings.Split(funcNames, ",")
+	if iface != "" && (funcNames != "" || receiver != "") {
+		log.Fatal("-interface cannot be used with -func or -receiver")
+	}
+	if !contains(codecs, codec) {
+		log.Fatalf("unknown codec %q, expected one of %v", codec, codecs)
+	}
+	if !contains(helpersModes, helpers) {
+		log.Fatalf("unknown helpers mode %q, expected one of %v", helpers, helpersModes)
+	}
 
 	// We accept either one directory or a list of files. Which do we have?
 	args := flag.Args()
@@ -251,70 +549,122 @@ func main() {
 	// Parse the package once.
 	var (
 		dir string
-		g   Generator
+		g   = Generator{helpers: helpers}
 	)
 	if len(args) == 1 && utils.IsDirectory(args[0]) {
 		dir = args[0]
-		g.parsePackageDir(args[0])
 	} else {
 		dir = filepath.Dir(args[0])
-		g.parsePackageFiles(args)
 	}
+	g.parsePackage(args)
+	g.checkHelpers(dir)
+	g.pkg.codec = codec
+	g.pkg.middleware = middleware
 
-	// Print the header and package clause.
-	g.Printf("// Code generated by \"varhandler %s\"; DO NOT EDIT\n", strings.Join(os.Args[1:], " "))
-	g.Printf("\n")
-	g.Printf("package %s\n", g.pkg.name)
-	g.Printf("\n")
-	g.Printf("import \"net/http\"\n") // Used by all methods.
+	var funcs []funcRef
+	if funcNames == "" && iface == "" {
+		funcs = g.pkg.routedMethods(receiver)
+		if len(funcs) == 0 {
+			log.Fatalf("%s has no method with a %sroute", receiver, directivePrefix)
+		}
+	}
+	for _, name := range strings.Split(funcNames, ",") {
+		if name == "" {
+			continue
+		}
+		ref, err := parseFuncRef(name, receiver)
+		if err != nil {
+			log.Fatal(err)
+		}
+		funcs = append(funcs, ref)
+	}
+
+	outputName := output
+	if outputName == "" {
+		switch {
+		case iface != "":
+			outputName = filepath.Join(dir, fmt.Sprintf("%s_handler_generated.go", strings.ToLower(iface)))
+		case funcNames == "":
+			outputName = filepath.Join(dir, fmt.Sprintf("%s_handlers_generated.go", strings.ToLower(receiver)))
+		case len(funcs) == 1 && funcs[0].Receiver != "":
+			outputName = filepath.Join(dir, fmt.Sprintf("%s_%s_handler_generated.go", strings.ToLower(funcs[0].Receiver), strings.ToLower(funcs[0].Name)))
+		case len(funcs) == 1:
+			outputName = filepath.Join(dir, fmt.Sprintf("%s_handler_generated.go", strings.ToLower(funcs[0].Name)))
+		default:
+			outputName = filepath.Join(dir, "generated_varhandlers.go")
+		}
+	}
+
+	g.imports.add("net/http", "http", "") // Used by all methods.
 
 	var definitions []FuncDefinition
 
-	for _, funcName := range funcs {
+	for _, ref := range funcs {
 		// generate import for func if any
 		// and generate definition of func for latter call
-		definitions = append(definitions, g.generateImportPaths(funcName))
+		definitions = append(definitions, g.generateImportPaths(ref))
 	}
+	if iface != "" {
+		definitions = g.generateInterface(iface)
+	}
+	// every failure was reported: fail go generate rather than
+	// writing handlers that leave some out, or don't compile
+	failed := 0
 	for _, definition := range definitions {
-		if definition.Name != "" { // func was found
-			log.Printf("Defining: %s", definition.Name)
-			g.writeFuncDef(definition)
+		if definition.Name == "" {
+			failed++
 		}
 	}
+	if failed > 0 {
+		log.Fatalf("%d of %d funcs could not be generated, nothing was written", failed, len(definitions))
+	}
+	if iface != "" {
+		g.writeAdapter(iface, outputName, definitions)
+	}
+	for _, definition := range definitions {
+		log.Printf("Defining: %s", definition.Name)
+		g.writeFuncDef(definition)
+	}
+	g.writeRegister(register, outputName, definitions)
+	g.writeRoutes(outputName, definitions)
+	// Handlers are written first as they tell what to import.
+	handlers := g.buf.String()
+	g.buf.Reset()
+
+	// Print the header, package clause and imports.
+	g.Printf("// Code generated by \"varhandler %s\"; DO NOT EDIT\n", strings.Join(os.Args[1:], " "))
+	g.Printf("\n")
+	g.Printf("package %s\n", g.pkg.name)
+	g.Printf("\n")
+	g.imports.print(&g)
+	g.Printf("%s", handlers)
 	// Format the output.
 	src := g.format()
 
-	// Write to file.
-	outputName := output
-	if outputName == "" {
-		if len(funcs) == 1 {
-			outputName = filepath.Join(dir, fmt.Sprintf("%s_handler_generated.go", strings.ToLower(funcs[0])))
-		} else {
-			outputName = filepath.Join(dir, "generated_varhandlers.go")
-		}
+	// The OpenAPI document fails on conflicting routes:
+	// write it first, for a failure to write neither.
+	if openapi != "" {
+		g.writeOpenAPI(openapi, definitions)
 	}
+	// Write to file.
 	err := ioutil.WriteFile(outputName, src, 0644)
 	if err != nil {
 		log.Fatalf("writing output: %s", err)
 	}
-
-	// copy helper file to pkg
-	utilsFile := "varhandler_helpers.go"
-
-	// copy file utils
-	_, currFile, _, ok := runtime.Caller(0)
-	if !ok {
-		log.Fatalf("No caller information")
+	if client != "" {
+		g.writeClient(client, definitions)
 	}
 
-	utils.CopyFile(filepath.Join(dir, utilsFile), filepath.Join(filepath.Dir(currFile), utilsFile), 0)
+	g.writeHelpers(dir)
 }
 
 // Generator holds the state of the analysis. Primarily used to buffer
 // the output for format.Source.
 type Generator struct {
-	buf bytes.Buffer // Accumulated output.
-	pkg *Package     // Package we are scanning.
+	buf     bytes.Buffer // Accumulated output.
+	pkg     *Package     // Package we are scanning.
+	imports importSet    // Imports of the generated file.
+	helpers string       // -helpers mode.
 }
 
 func (g *Generator) Printf(format string, args ...interface{}) {
@@ -328,137 +678,119 @@ type File struct {
 
 	// These fields are reset for each func being generated.
 	funcDefinition FuncDefinition
-	found          bool
+	declared       bool // the func is declared in the file
+	found          bool // and could be generated
 }
 
 type Package struct {
-	dir      string
-	name     string
-	defs     map[*ast.Ident]types.Object
-	pkgs     map[string]*types.Package
-	files    []*File
-	typesPkg *types.Package
-}
-
-// parsePackageDir parses the package residing in the directory.
-func (g *Generator) parsePackageDir(directory string) {
-	pkg, err := build.Default.ImportDir(directory, 0)
-	if err != nil {
-		log.Fatalf("cannot process directory %s: %s", directory, err)
-	}
-	var names []string
-	names = append(names, pkg.GoFiles...)
-	names = append(names, pkg.CgoFiles...)
-	// TODO: Need to think about constants in test files. Maybe write type_string_test.go
-	// in a separate pass? For later.
-	// names = append(names, pkg.TestGoFiles...) // These are also in the "foo" package.
-	names = append(names, pkg.SFiles...)
-	names = prefixDirectory(directory, names)
-	g.parsePackage(directory, names, nil)
-}
-
-// parsePackageFiles parses the package occupying the named files.
-func (g *Generator) parsePackageFiles(names []string) {
-	g.parsePackage(".", names, nil)
+	fset       *token.FileSet
+	dir        string
+	name       string
+	defs       map[*ast.Ident]types.Object
+	info       *types.Info
+	decls      map[types.Object]*ast.FuncDecl
+	pkgs       map[string]*types.Package
+	files      []*File
+	typesPkg   *types.Package
+	codec      string // default codec of responses
+	middleware string // default middleware of handlers, comma-separated
 }
 
-// prefixDirectory places the directory name on the beginning of each name in the list.
-func prefixDirectory(directory string, names []string) []string {
-	if directory == "." {
-		return names
+// importDefinition imports the packages of the instantiators
+// and of the middleware of fd.
+func (g *Generator) importDefinition(fd *FuncDefinition) {
+	for i, param := range fd.Instantiations {
+		if param.PackagePath != "" {
+			fd.Instantiations[i].Package = g.imports.add(param.PackagePath, param.packageName, param.Package)
+		}
 	}
-	ret := make([]string, len(names))
-	for i, name := range names {
-		ret[i] = filepath.Join(directory, name)
+	for i, m := range fd.Middleware {
+		if m.PackagePath != "" {
+			fd.Middleware[i].Package = g.imports.add(m.PackagePath, m.packageName, m.Package)
+		}
 	}
-	return ret
 }
 
-// parsePackage analyzes the single package constructed from the named files.
-// If text is non-nil, it is a string to be used instead of the content of the file,
-// to be used for testing. parsePackage exits if there is an error.
-func (g *Generator) parsePackage(directory string, names []string, text interface{}) {
-	var files []*File
-	var astFiles []*ast.File
-	g.pkg = new(Package)
-	fs := token.NewFileSet()
-	for _, name := range names {
-		if !strings.HasSuffix(name, ".go") {
-			continue
-		}
-		parsedFile, err := parser.ParseFile(fs, name, text, 0)
-		if err != nil {
-			log.Fatalf("parsing package: %s: %s", name, err)
+// parsePackage loads the package named by args: a single directory
+// or a set of files. parsePackage exits if the package has errors.
+func (g *Generator) parsePackage(args []string) {
+	pkg, err := loader.Load(args)
+	if list, ok := err.(*loader.ErrorList); ok && pkg != nil {
+		// the package can use handlers, or Routes methods, that are yet
+		// to be generated, and handlers already generated can be out of date
+		generated := make(map[string]bool)
+		for _, file := range pkg.Files {
+			if len(file.Comments) > 0 && strings.HasPrefix(file.Comments[0].Text(), `Code generated by `) &&
+				strings.Contains(file.Comments[0].Text(), "varhandler") {
+				generated[pkg.Fset.Position(file.Pos()).Filename] = true
+			}
 		}
-		astFiles = append(astFiles, parsedFile)
-		files = append(files, &File{
-			file: parsedFile,
-			pkg:  g.pkg,
+		err = list.Without(func(e loader.Error) bool {
+			m := undefinedError.FindStringSubmatch(e.Msg)
+			return generated[e.Pos.Filename] || m != nil && g.generatedName(m[1]+m[2])
 		})
 	}
-	if len(astFiles) == 0 {
-		log.Fatalf("%s: no buildable Go files", directory)
-	}
-	g.pkg.name = astFiles[0].Name.Name
-	g.pkg.files = files
-	g.pkg.dir = directory
-	// Type check the package.
-	g.pkg.check(fs, astFiles)
-}
-
-// check type-checks the package. The package must be OK to proceed.
-func (pkg *Package) check(fs *token.FileSet, astFiles []*ast.File) {
-	pkg.defs = make(map[*ast.Ident]types.Object)
-	config := types.Config{
-		FakeImportC: true,
-		Importer:    importer.Default(),
+	if err != nil {
+		log.Fatal(err)
 	}
-	info := &types.Info{
-		Defs: pkg.defs,
+	g.pkg = &Package{
+		fset:     pkg.Fset,
+		dir:      pkg.Dir,
+		name:     pkg.Name,
+		defs:     pkg.Info.Defs,
+		info:     pkg.Info,
+		decls:    make(map[types.Object]*ast.FuncDecl),
+		typesPkg: pkg.Types,
 	}
-	typesPkg, err := config.Check(pkg.dir, fs, astFiles, info)
-	if err != nil {
-		log.Fatalf("checking package: %s", err)
+	for _, file := range pkg.Files {
+		g.pkg.files = append(g.pkg.files, &File{
+			file: file,
+			pkg:  g.pkg,
+		})
+		for _, decl := range file.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok {
+				g.pkg.decls[pkg.Info.Defs[fn.Name]] = fn
+			}
+		}
 	}
-	pkg.typesPkg = typesPkg
+}
+
+// undefinedError matches the type errors of a name that is not declared.
+var undefinedError = regexp.MustCompile(`^undefined: (\w+)$|has no field or method (\w+)`)
+
+// generatedName tells whether name can be declared by varhandler in a
+// file yet to be generated: a handler, an adapter, a Routes method, a
+// Register func, the Client or, in copy mode, a helper.
+func (g *Generator) generatedName(name string) bool {
+	return strings.HasSuffix(name, "Handler") || strings.HasPrefix(name, "Register") ||
+		name == "Routes" || name == clientName || g.helpers == "copy" && helperNames[name]
 }
 
 // generateImportPaths parses the funcs that are going to be called
-// and generates import paths if any generator is in another pkg
-func (g *Generator) generateImportPaths(funcName string) FuncDefinition {
-	found := false
+// and imports, by path, the pkgs of generators from another pkg.
+// It returns an empty definition, once the reason is logged,
+// for a func that is not found or can't be generated.
+func (g *Generator) generateImportPaths(ref funcRef) FuncDefinition {
+	declared := false
 	for _, file := range g.pkg.files {
 		// Set the state for this run of the walker.
-		file.found = false
+		file.declared, file.found = false, false
 		file.funcDefinition = FuncDefinition{
-			Name: funcName,
+			Name:     ref.Name,
+			Receiver: ref.Receiver,
 		}
 		if file.file != nil {
 			ast.Inspect(file.file, file.genDecl)
 			if file.found {
-				for _, param := range file.funcDefinition.Params {
-					if param.Package != "" {
-						imported := false
-						for _, pkg := range g.pkg.typesPkg.Imports() {
-							if pkg.Name() == param.Package {
-								g.Printf("import %s \"%s\"\n", param.Package, pkg.Path())
-								imported = true
-							}
-						}
-						if imported == false {
-							log.Fatalf("could not find pkg %s", param.Package)
-						}
-					}
-				}
-
-				found = true
+				g.importDefinition(&file.funcDefinition)
 				return file.funcDefinition
 			}
+			declared = declared || file.declared
 		}
 	}
 
-	if !found {
-		fmt.Printf("Func not found: %s", funcName)
+	if !declared {
+		log.Printf("Func not found: %s", ref)
 	}
 	return FuncDefinition{}
 }
@@ -483,14 +815,19 @@ func (f *File) genDecl(node ast.Node) bool {
 		// We only care about func declarations.
 		return true
 	}
-	if decl.Name.Name == f.funcDefinition.Name {
+	if decl.Name.Name == f.funcDefinition.Name && receiverName(decl) == f.funcDefinition.Receiver && (decl.Recv == nil) == (f.funcDefinition.Receiver == "") {
+		f.declared = true
 		if len(decl.Type.Params.List) == 0 {
 			log.Printf("%s should take at least one parameter, found %d instead", f.funcDefinition.Name, len(decl.Type.Params.List))
 			return false
 		}
-		ok := f.funcDefinition.ParseResults(decl.Type.Results)
+		f.funcDefinition.Doc = decl.Doc.Text()
+		ok := f.funcDefinition.ParseResults(f.pkg, decl.Pos(), f.pkg.signature(decl.Name))
+		if ok {
+			ok = f.funcDefinition.ParseArguments(f.pkg, f.file, decl.Type.Params.List)
+		}
 		if ok {
-			ok = f.funcDefinition.ParseArguments(decl.Type.Params.List)
+			ok = f.funcDefinition.ParseDirectives(f.pkg, f.file, decl.Doc)
 		}
 
 		f.found = ok
@@ -498,49 +835,223 @@ func (f *File) genDecl(node ast.Node) bool {
 	return false
 }
 
+// signature returns the signature of the func or method declared by name.
+func (pkg *Package) signature(name *ast.Ident) *types.Signature {
+	if fn, ok := pkg.info.Defs[name].(*types.Func); ok {
+		return fn.Type().(*types.Signature)
+	}
+	return types.NewSignatureType(nil, nil, nil, nil, nil, false) // reported as returning no error
+}
+
+// typeString returns the name of t in the generated code
+// and imports the pkgs it refers to.
+func (g *Generator) typeString(t types.Type) string {
+	return types.TypeString(t, func(pkg *types.Package) string {
+		if pkg == g.pkg.typesPkg {
+			return ""
+		}
+		return g.imports.add(pkg.Path(), pkg.Name(), "")
+	})
+}
+
 // writeFuncDef generates an handler func
 func (g *Generator) writeFuncDef(fd FuncDefinition) {
 	funcMap := template.FuncMap{
-		"ToLower": strings.ToLower,
+		"ToLower":   strings.ToLower,
+		"Type":      g.typeString,
+		"MediaType": func(codec string) string { return codecMediaTypes[codec] },
+		"Status":    statusName,
+		"Join":      strings.Join,
+		"Helper":    g.helper,
 	}
 
-	t := template.Must(template.New("varhandler").Funcs(funcMap).Parse(handlerWrap))
+	t := template.Must(template.New("varhandler").Funcs(funcMap).Parse(handlerWrap + bindingsWrap))
 
 	err := t.Execute(&g.buf, fd)
 	checkError(err)
 }
 
 const handlerWrap = `
-func {{.Name}}Handler(w http.ResponseWriter, r *http.Request) {
+func {{if .Receiver}}(s *{{.Receiver}}) {{end}}{{.Name}}Handler(w http.ResponseWriter, r *http.Request) {
+	w = {{Helper "NewResponseWriter"}}(w)
+	defer {{Helper "Recover"}}(w, r)
+	o := {{Helper "Observe"}}(w, r, "{{if .Receiver}}{{.Receiver}}.{{end}}{{.Name}}")
 	var err error
-{{range $i, $param := .Params}}
-	param{{$i}}, err := {{if ne $param.Package ""}}{{$param.Package}}.{{end}}{{$param.GeneratorName}}(r)
+	ctx := r.Context()
+{{- if .MaxBody}}
+	r.Body = http.MaxBytesReader(w, r.Body, {{.MaxBody}})
+{{- end}}
+{{- if .Multipart}}
+	defer {{Helper "RemoveMultipartForm"}}(r)
+{{- end}}
+	if err = ctx.Err(); err != nil {
+		{{Helper "HandleContextError"}}(w, r, err) // client is gone
+		return
+	}
+{{range $i, $param := .Instantiations}}
+	o.Start()
+{{- if $param.Bindings}}
+	{{template "bindings" $param}}
+{{- else}}
+	{{$param.Var}}, err := {{if $param.Method}}s.{{else if ne $param.Package ""}}{{$param.Package}}.{{end}}{{$param.GeneratorName}}({{if $param.Context}}ctx, {{end}}r{{range $param.Deps}}, {{.}}{{end}})
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusBadRequest, err)
+		o.Instantiated({{printf "%q" $param.Name}}, err)
+		{{Helper "HandleHTTPErrorWithDefaultStatus"}}(w, r, {{Status $param.ErrorStatus}}, err)
+		return
+	}
+{{- end}}
+{{- if $param.Validate}}
+	if err = {{$param.Var}}.Validate({{if $param.ValidateContext}}ctx{{end}}); err != nil {
+		err = &{{Helper "ValidationError"}}{Err: err}
+		o.Instantiated({{printf "%q" $param.Name}}, err)
+		{{Helper "HandleHTTPErrorWithDefaultStatus"}}(w, r, http.StatusUnprocessableEntity, err)
+		return
+	}
+{{- end}}
+	o.Instantiated({{printf "%q" $param.Name}}, nil)
+	if err = ctx.Err(); err != nil {
+		{{Helper "HandleContextError"}}(w, r, err) // client is gone
 		return
 	}
 {{end}}
 {{if .Response}}
-	var resp interface{}
+	var resp {{Type .ResponseType}}
 {{end}}
 {{if .Status}}
-	var status int
+	var status {{Type .StatusType}}
+{{end}}
+{{if .Header}}
+	var header http.Header
 {{end}}
-	{{if .Response}}resp, {{end}}{{if .Status}}status, {{end}}err = {{.Name}}({{range $i, $param := .Params}} {{if gt $i 0}},{{end}} param{{$i}}{{end}})
+	o.Start()
+	{{Join .Results ", "}} = {{if .Receiver}}s.{{end}}{{.Name}}({{if .Context}}ctx{{if .Params}}, {{end}}{{end}}{{range $i, $param := .Params}} {{if gt $i 0}},{{end}} {{$param.Var}}{{end}})
+	o.Called(err)
 	if err != nil {
-		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+		{{Helper "HandleHTTPErrorWithDefaultStatus"}}(w, r, http.StatusInternalServerError, err)
 		return
 	}
-{{if .Status}}
+{{if .Header}}
+	{{Helper "CopyHeader"}}(w, header)
+{{end}}
+{{if .Response}}
+	{{Helper "EncodeResponse"}}(w, r, {{MediaType .Codec | printf "%q"}}, {{if .Status}}{{.StatusInt}}{{else}}0{{end}}, resp)
+{{else if .Status}}
 	if status != 0 {
-		w.WriteHeader(status)
+		w.WriteHeader({{.StatusInt}})
 	}
 {{end}}
-{{if .Response}}
-	if resp != nil {
-		HandleHTTPResponse(w, r, resp)
+}
+`
+
+// bindingsWrap instantiates a struct param from its tagged fields.
+const bindingsWrap = `
+{{define "bindings"}}
+	{{- if and .Pointer (not .File)}}{{.Var}} := new({{Type .Elem}}){{else}}var {{.Var}} {{Type .Type}}{{end}}
+{{- if .Multipart}}
+	if err = {{Helper "ParseMultipartForm"}}(r); err != nil {
+		o.Instantiated({{printf "%q" .Name}}, err)
+		{{Helper "HandleHTTPErrorWithDefaultStatus"}}(w, r, http.StatusBadRequest, err)
+		return
+	}
+{{- end}}
+{{- range $b := .Bindings}}
+{{- if eq $b.In "file"}}
+	if err = {{Helper $b.Setter}}(r, {{printf "%q" $b.Name}}, &{{$.Var}}{{if $b.Field}}.{{$b.Field}}{{end}}); err != nil{{if $b.Field}} && err != http.ErrMissingFile{{end}} {
+		err = &{{Helper "FieldError"}}{Field: {{printf "%q" $b.Field}}, In: "file", Name: {{printf "%q" $b.Name}}, Err: err}
+		o.Instantiated({{printf "%q" $.Name}}, err)
+		{{Helper "HandleHTTPErrorWithDefaultStatus"}}(w, r, http.StatusBadRequest, err)
+		return
+	}
+{{- if $b.Opens}}
+	defer {{Helper "CloseFormFile"}}({{$.Var}}{{if $b.Field}}.{{$b.Field}}{{end}})
+{{- end}}
+{{- else if eq $b.In "body"}}
+	if err = {{if $.Strict}}{{Helper "DecodeStrictBody"}}{{else}}{{Helper "DecodeBody"}}{{end}}(r, {{MediaType $b.Name | printf "%q"}}, &{{$.Var}}.{{$b.Field}}); err != nil {
+		err = &{{Helper "FieldError"}}{Field: {{printf "%q" $b.Field}}, In: "body", Name: {{printf "%q" $b.Name}}, Err: err}
+		o.Instantiated({{printf "%q" $.Name}}, err)
+		{{Helper "HandleHTTPErrorWithDefaultStatus"}}(w, r, http.StatusBadRequest, err)
+		return
 	}
+{{- else}}
+	if v := {{$b.Source (Helper "CookieValue")}}; v != "" {
+		if err = {{if $b.Setter}}{{Helper $b.Setter}}(&{{$.Var}}.{{$b.Field}}, v){{else}}{{$.Var}}.{{$b.Field}}.UnmarshalText([]byte(v)){{end}}; err != nil {
+			err = &{{Helper "FieldError"}}{Field: {{printf "%q" $b.Field}}, In: {{printf "%q" $b.In}}, Name: {{printf "%q" $b.Name}}, Err: err}
+			o.Instantiated({{printf "%q" $.Name}}, err)
+			{{Helper "HandleHTTPErrorWithDefaultStatus"}}(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+{{- end}}
+{{- end}}
 {{end}}
+`
+
+// writeRegister generates the func registering on a mux
+// the handlers that have routes, if any.
+func (g *Generator) writeRegister(name, outputName string, definitions []FuncDefinition) {
+	var routed []FuncDefinition
+	mux := http.NewServeMux()
+	for _, fd := range definitions {
+		if fd.Receiver != "" {
+			continue // see writeRoutes and writeAdapter
+		}
+		for _, pattern := range fd.Routes {
+			if err := registerPattern(mux, pattern); err != nil {
+				log.Fatalf("%s: route %q: %s", fd.Name, pattern, err)
+			}
+		}
+		if len(fd.Routes) > 0 {
+			routed = append(routed, fd)
+		}
+	}
+	if len(routed) == 0 {
+		return
+	}
+	if obj := g.pkg.typesPkg.Scope().Lookup(name); obj != nil && !sameFile(g.pkg.fset.Position(obj.Pos()).Filename, outputName) {
+		log.Fatalf("%s is already declared at %s, choose another name with -register", name, g.pkg.fset.Position(obj.Pos()))
+	}
+
+	t := template.Must(template.New("register").Parse(registerWrap))
+	err := t.Execute(&g.buf, struct {
+		Name        string
+		Definitions []FuncDefinition
+	}{name, routed})
+	checkError(err)
+}
+
+// registerPattern registers pattern on mux,
+// returning the panic of an invalid or conflicting pattern.
+func registerPattern(mux *http.ServeMux, pattern string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	mux.HandleFunc(pattern, http.NotFound)
+	return nil
+}
+
+// sameFile reports whether the paths a and b name the same file.
+func sameFile(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	return err == nil && os.SameFile(ai, bi)
+}
+
+const registerWrap = `
+// {{.Name}} registers on mux the generated handlers, wrapped by
+// their middleware, with the patterns of their //varhandler:route directives.
+func {{.Name}}(mux *http.ServeMux) {
+{{- range $fd := .Definitions}}{{range .Routes}}
+{{- if $fd.Middleware}}
+	mux.Handle({{printf "%q" .}}, {{$fd.Wrap (printf "%sHandler" $fd.Name)}})
+{{- else}}
+	mux.HandleFunc({{printf "%q" .}}, {{$fd.Name}}Handler)
+{{- end}}
+{{- end}}{{end}}
 }
 `
 
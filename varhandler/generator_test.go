@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// varhandlerBin is the varhandler binary the tests run, built by TestMain.
+var varhandlerBin string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "varhandler")
+	if err != nil {
+		panic(err)
+	}
+	varhandlerBin = filepath.Join(dir, "varhandler")
+	out, err := exec.Command("go", "build", "-o", varhandlerBin, ".").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		panic("building varhandler: " + string(out))
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// isGenerated tells whether the file at path was written by varhandler.
+func isGenerated(t *testing.T, path string) bool {
+	t.Helper()
+	if filepath.Base(path) == "openapi.json" {
+		return true
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.HasPrefix(b, []byte("// Code generated by "))
+}
+
+// copyModule copies the module the tests run in to dir,
+// leaving out the files varhandler generates.
+func copyModule(t *testing.T, dir string) {
+	t.Helper()
+	root, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(filepath.Join(dir, rel), 0755)
+		}
+		if isGenerated(t, path) {
+			return nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, rel), b, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestExamples runs go generate on a copy of the examples, without the
+// files generated already, and compares what it generates to them: the
+// results of every shape, imports, routes, the client and the OpenAPI
+// document the examples declare.
+func TestExamples(t *testing.T) {
+	if testing.Short() {
+		t.Skip("generates every example")
+	}
+	dir := t.TempDir()
+	copyModule(t, dir)
+	examples := filepath.Join(dir, "varhandler", "examples")
+	cmd := exec.Command("go", "generate", ".")
+	cmd.Dir = examples
+	cmd.Env = append(os.Environ(), "PATH="+filepath.Dir(varhandlerBin)+string(os.PathListSeparator)+os.Getenv("PATH"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go generate: %s\n%s", err, out)
+	}
+
+	want, err := filepath.Glob(filepath.Join("examples", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	generated := make(map[string]bool)
+	for _, path := range want {
+		if fi, err := os.Stat(path); err != nil || fi.IsDir() || !isGenerated(t, path) {
+			continue
+		}
+		name := filepath.Base(path)
+		generated[name] = true
+		wantSrc, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotSrc, err := os.ReadFile(filepath.Join(examples, name))
+		if err != nil {
+			t.Errorf("%s was not generated: %s", name, err)
+			continue
+		}
+		if !bytes.Equal(gotSrc, wantSrc) {
+			t.Errorf("%s differs from what go generate writes, run go generate in examples", name)
+		}
+	}
+	got, _ := filepath.Glob(filepath.Join(examples, "*"))
+	for _, path := range got {
+		if fi, err := os.Stat(path); err != nil || fi.IsDir() {
+			continue
+		}
+		if name := filepath.Base(path); !generated[name] && isGenerated(t, path) {
+			t.Errorf("%s is generated but not checked in", name)
+		}
+	}
+
+	build := exec.Command("go", "vet", ".")
+	build.Dir = examples
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Errorf("go vet of the generated examples: %s\n%s", err, out)
+	}
+}
+
+// generate runs varhandler with args on a package made of src, in a module
+// requiring the one the tests run in, and returns the files it wrote and
+// what it logged.
+func generate(t *testing.T, src string, args ...string) (written []string, log string, err error) {
+	t.Helper()
+	root, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	goMod := "module example.com/p\n\ngo 1.23\n\nrequire github.com/azr/generators v0.0.0\n\nreplace github.com/azr/generators => " + root + "\n"
+	for name, content := range map[string]string{"go.mod": goMod, "p.go": src} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command(varhandlerBin, args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if name := e.Name(); name != "go.mod" && name != "p.go" {
+			written = append(written, name)
+		}
+	}
+	return written, string(out), err
+}
+
+func TestGenerate(t *testing.T) {
+	written, log, err := generate(t, `package p
+
+import "net/http"
+
+type A int
+
+func HTTPA(r *http.Request) (A, error) { return 0, nil }
+
+type B int
+
+// HTTPB takes the A HTTPA instantiated.
+func HTTPB(r *http.Request, a A) (B, error) { return B(a), nil }
+
+//varhandler:route GET /b
+func GetB(a A, b B) (status int, err error) { return http.StatusNoContent, nil }
+
+var _ = RegisterHandlers
+`, "-func", "GetB", "-openapi", "openapi.json")
+	if err != nil {
+		t.Fatalf("varhandler: %s\n%s", err, log)
+	}
+	if strings.Join(written, " ") != "getb_handler_generated.go openapi.json" {
+		t.Errorf("varhandler wrote %v, want the handler and the OpenAPI document", written)
+	}
+}
+
+// TestDiagnostics checks that every func that can't be generated is
+// reported, and that nothing is written then.
+func TestDiagnostics(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		src  string
+		args []string
+		want []string // in the log
+	}{
+		{
+			name: "cycle and missing provider",
+			src: `package p
+
+import "net/http"
+
+type A int
+type B int
+
+func HTTPA(r *http.Request, b B) (A, error) { return 0, nil }
+func HTTPB(r *http.Request, a A) (B, error) { return 0, nil }
+
+func Cyc(a A) error { return nil }
+
+func Put(c chan int) error { return nil }
+`,
+			args: []string{"-func", "Put,Cyc,Nope"},
+			want: []string{
+				"Put: no instantiator found for chan int",
+				"Cyc: instantiator cycle: A (HTTPA) -> B (HTTPB) -> A",
+				"Func not found: Nope\n",
+				"3 of 3 funcs could not be generated, nothing was written",
+			},
+		},
+		{
+			name: "routes documented as the same operation",
+			src: `package p
+
+import "net/http"
+
+type A int
+
+func HTTPA(r *http.Request) (A, error) { return 0, nil }
+
+//varhandler:route GET a.example/x
+func One(a A) error { return nil }
+
+//varhandler:route GET b.example/x
+func Two(a A) error { return nil }
+`,
+			args: []string{"-func", "One,Two", "-openapi", "openapi.json"},
+			want: []string{`Two: route "GET b.example/x" is documented as GET /x, like route "GET a.example/x" of One`},
+		},
+		{
+			name: "error in the package",
+			src: `package p
+
+import "net/http"
+
+type A int
+
+func HTTPA(r *http.Request) (A, error) { return 0, nil }
+
+func One(a A) error { return Typo }
+`,
+			args: []string{"-func", "One"},
+			want: []string{"undefined: Typo"},
+		},
+		{
+			name: "helpers declared by the package",
+			src: `package p
+
+import "net/http"
+
+type A int
+
+func HTTPA(r *http.Request) (A, error) { return 0, nil }
+
+func One(a A) error { return nil }
+
+type Problem struct{}
+`,
+			args: []string{"-func", "One", "-helpers", "copy"},
+			want: []string{"would be declared twice: Problem at "},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			written, log, err := generate(t, test.src, test.args...)
+			if err == nil {
+				t.Errorf("varhandler succeeded, want it to fail:\n%s", log)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(log, want) {
+					t.Errorf("varhandler logged:\n%s\nwant %q", log, want)
+				}
+			}
+			if len(written) > 0 {
+				t.Errorf("varhandler wrote %v, want nothing", written)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// runtimePath is the import path of the
+// runtime pkg, holding the helpers.
+const runtimePath = "github.com/azr/generators/varhandler/varhttp"
+
+// helpersSource is the source of the helpers,
+// as written into a package with -helpers=copy.
+//
+//go:embed varhttp/varhttp.go
+var helpersSource string
+
+// helpersFile is the file the helpers are written to with -helpers=copy.
+const helpersFile = "varhandler_helpers.go"
+
+// helperNames are the top level names the helpers declare.
+var helperNames = declaredNames(helpersSource)
+
+// declaredNames returns the top level names declared in src.
+func declaredNames(src string) map[string]bool {
+	f, err := parser.ParseFile(token.NewFileSet(), helpersFile, src, 0)
+	checkError(err)
+	names := make(map[string]bool)
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil {
+				names[decl.Name.Name] = true
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					names[spec.Name.Name] = true
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						names[name.Name] = true
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// helpersModes are the values of -helpers:
+// copy writes the helpers into the package being generated,
+// import makes the generated code call the ones of the runtime pkg.
+var helpersModes = []string{"copy", "import"}
+
+// helper returns the name of the helper func or type
+// name in the generated code, importing the runtime if needed.
+func (g *Generator) helper(name string) string {
+	if g.helpers != "import" {
+		return name
+	}
+	return g.imports.add(runtimePath, "varhttp", "") + "." + name
+}
+
+// checkHelpers fails, in copy mode, when the package declares
+// a name of the helpers out of their file: writing them would
+// break its build.
+func (g *Generator) checkHelpers(dir string) {
+	if g.helpers != "copy" {
+		return
+	}
+	var clashes []string
+	for name := range helperNames {
+		obj := g.pkg.typesPkg.Scope().Lookup(name)
+		if obj != nil && !sameFile(g.pkg.fset.Position(obj.Pos()).Filename, filepath.Join(dir, helpersFile)) {
+			clashes = append(clashes, fmt.Sprintf("%s at %s", name, g.pkg.fset.Position(obj.Pos())))
+		}
+	}
+	if len(clashes) > 0 {
+		sort.Strings(clashes)
+		log.Fatalf("the helpers of %s would be declared twice: %s; rename them or use -helpers=import",
+			helpersFile, strings.Join(clashes, ", "))
+	}
+}
+
+// writeHelpers writes, in copy mode, the helpers into
+// dir with the name of the package being generated.
+func (g *Generator) writeHelpers(dir string) {
+	if g.helpers != "copy" {
+		return
+	}
+	src := strings.Replace(helpersSource, "package varhttp\n", "package "+g.pkg.name+"\n", 1)
+	src = "// Code generated by varhandler from " + runtimePath + "; DO NOT EDIT.\n\n" + src
+	if err := ioutil.WriteFile(filepath.Join(dir, helpersFile), []byte(src), 0644); err != nil {
+		log.Fatalf("writing helpers: %s", err)
+	}
+}
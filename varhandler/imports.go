@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// importSpec is an import of the generated file.
+type importSpec struct {
+	path string
+	name string // name used in the generated file, "." for a dot import
+	pkg  string // name declared by the package itself
+}
+
+// importSet holds the imports of the generated file,
+// one per path, whatever the number of funcs using it.
+type importSet struct {
+	specs []importSpec
+}
+
+// add imports path as name, keeping the name the user chose when possible,
+// and returns the qualifier to use in the generated code:
+// "" for a dot import, a free name if name is taken by another path.
+func (s *importSet) add(path, pkg, name string) string {
+	if name == "" {
+		name = pkg
+	}
+	for _, spec := range s.specs {
+		if spec.path == path {
+			return spec.qualifier()
+		}
+	}
+	if name != "." {
+		base := name
+		for i := 2; s.taken(name); i++ {
+			name = fmt.Sprintf("%s%d", base, i)
+		}
+	}
+	spec := importSpec{path: path, name: name, pkg: pkg}
+	s.specs = append(s.specs, spec)
+	return spec.qualifier()
+}
+
+// taken reports whether an import already uses name.
+func (s *importSet) taken(name string) bool {
+	for _, spec := range s.specs {
+		if spec.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// std reports whether spec imports a standard library pkg.
+func (spec importSpec) std() bool {
+	return !strings.Contains(strings.Split(spec.path, "/")[0], ".")
+}
+
+func (spec importSpec) qualifier() string {
+	if spec.name == "." {
+		return ""
+	}
+	return spec.name
+}
+
+// print writes the import block sorted by path,
+// standard library pkgs first.
+func (s *importSet) print(g *Generator) {
+	specs := append([]importSpec(nil), s.specs...)
+	sort.Slice(specs, func(i, j int) bool {
+		if specs[i].std() != specs[j].std() {
+			return specs[i].std()
+		}
+		return specs[i].path < specs[j].path
+	})
+
+	g.Printf("import (\n")
+	for i, spec := range specs {
+		if i > 0 && spec.std() != specs[i-1].std() {
+			g.Printf("\n")
+		}
+		if spec.name != spec.pkg {
+			g.Printf("\t%s %q\n", spec.name, spec.path)
+		} else {
+			g.Printf("\t%q\n", spec.path)
+		}
+	}
+	g.Printf(")\n")
+}
+
+// importName returns the name under which the package at path
+// is imported by the declaration of the param typed by expr.
+// The selectors of expr are looked at first, then the imports of file,
+// so that aliased and dot imports are kept.
+// It returns "" when the file doesn't import path.
+func (pkg *Package) importName(file *ast.File, expr ast.Expr, path string) string {
+	name := ""
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if name != "" {
+			return false
+		}
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); ok {
+			if pkgName, ok := pkg.info.Uses[x].(*types.PkgName); ok && pkgName.Imported().Path() == path {
+				name = pkgName.Name()
+			}
+		}
+		return true
+	})
+	if name != "" {
+		return name
+	}
+	for _, spec := range file.Imports {
+		obj := pkg.info.Implicits[spec]
+		if spec.Name != nil {
+			obj = pkg.info.Defs[spec.Name]
+		}
+		if pkgName, ok := obj.(*types.PkgName); ok && pkgName.Imported().Path() == path && pkgName.Name() != "_" {
+			return pkgName.Name()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/types"
+)
+
+// instantiatorInputs tells the values of the request a hand written
+// instantiator reads, as far as can be seen from the calls it makes:
+//  r.PathValue("id")                    // path
+//  r.URL.Query().Get("limit")           // query
+//  r.Header.Get("X-Request-Id")         // header
+//  r.Cookie("session")                  // cookie
+//  r.FormValue("name")                  // form, r.PostFormValue too
+//  json.NewDecoder(r.Body).Decode(&v)   // json body typed as v, xml too
+//
+// Values other than bodies are typed as strings.
+// Instantiators from other packages, that can't be read, have no inputs.
+func (pkg *Package) instantiatorInputs(fn *types.Func) []Binding {
+	decl := pkg.decls[fn]
+	if decl == nil || decl.Body == nil {
+		return nil
+	}
+	var request types.Object
+	for _, field := range decl.Type.Params.List {
+		for _, name := range field.Names {
+			if isHTTPRequest(pkg.info.TypeOf(field.Type)) {
+				request = pkg.info.Defs[name]
+			}
+		}
+	}
+	if request == nil {
+		return nil
+	}
+	isRequest := func(e ast.Expr) bool {
+		id, ok := e.(*ast.Ident)
+		return ok && pkg.info.Uses[id] == request
+	}
+	// isField tells whether e is r.name
+	isField := func(e ast.Expr, name string) bool {
+		sel, ok := e.(*ast.SelectorExpr)
+		return ok && sel.Sel.Name == name && isRequest(sel.X)
+	}
+
+	var inputs []Binding
+	add := func(b Binding) {
+		for _, input := range inputs {
+			if input.In == b.In && input.Name == b.Name {
+				return
+			}
+		}
+		inputs = append(inputs, b)
+	}
+	str := types.Typ[types.String]
+	ast.Inspect(decl.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || len(call.Args) != 1 {
+			return true
+		}
+		name, isConst := pkg.stringConstant(call.Args[0])
+		switch method := sel.Sel.Name; {
+		case !isConst && method == "Decode":
+			if format := pkg.bodyDecoder(sel.X, isField); format != "" {
+				if t := pkg.info.TypeOf(call.Args[0]); t != nil {
+					add(Binding{In: "body", Name: format, Type: deref(t)})
+				}
+			}
+		case !isConst:
+		case isRequest(sel.X) && method == "PathValue":
+			add(Binding{In: "path", Name: name, Type: str})
+		case isRequest(sel.X) && method == "Cookie":
+			add(Binding{In: "cookie", Name: name, Type: str})
+		case isRequest(sel.X) && (method == "FormValue" || method == "PostFormValue"):
+			add(Binding{In: "form", Name: name, Type: str})
+		case isField(sel.X, "Header") && method == "Get":
+			add(Binding{In: "header", Name: name, Type: str})
+		case method == "Get":
+			// r.URL.Query().Get
+			query, ok := sel.X.(*ast.CallExpr)
+			if !ok {
+				break
+			}
+			fun, ok := query.Fun.(*ast.SelectorExpr)
+			if ok && fun.Sel.Name == "Query" && isField(fun.X, "URL") {
+				add(Binding{In: "query", Name: name, Type: str})
+			}
+		}
+		return true
+	})
+	return inputs
+}
+
+// bodyDecoder returns the format of a decoder of the request's body:
+// "json" for json.NewDecoder(r.Body), "xml" for xml.NewDecoder(r.Body).
+func (pkg *Package) bodyDecoder(e ast.Expr, isField func(ast.Expr, string) bool) string {
+	call, ok := e.(*ast.CallExpr)
+	if !ok || len(call.Args) != 1 || !isField(call.Args[0], "Body") {
+		return ""
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "NewDecoder" {
+		return ""
+	}
+	x, ok := sel.X.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+	pkgName, ok := pkg.info.Uses[x].(*types.PkgName)
+	if !ok {
+		return ""
+	}
+	switch pkgName.Imported().Path() {
+	case "encoding/json":
+		return "json"
+	case "encoding/xml":
+		return "xml"
+	}
+	return ""
+}
+
+// stringConstant returns the value of e if it's a constant string.
+func (pkg *Package) stringConstant(e ast.Expr) (string, bool) {
+	tv, ok := pkg.info.Types[e]
+	if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+		return "", false
+	}
+	return constant.StringVal(tv.Value), true
+}
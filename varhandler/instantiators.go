@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"go/types"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// instantiatorPrefix starts the name of every http instantiator.
+const instantiatorPrefix = "HTTP"
+
+// findInstantiator returns the func that instantiates a param of type t:
+//  func HTTPX(r *http.Request) (T, error)
+//  func HTTPX(ctx context.Context, r *http.Request) (T, error)
+//
+// Params after the request are instantiated first, see instantiatorDeps.
+//
+// For the handler of a method, it is first searched in the methods
+// of its receiver, so that instantiators can use its dependencies:
+//  func (s *UserService) HTTPUser(r *http.Request) (User, error)
+//
+// It is then searched in the package being generated then,
+// for a named type (or a pointer to one) from another package,
+// in the package declaring that type.
+// When more than one func can instantiate t, the one named
+// after the type is picked: HTTPX for X or *X.
+func (pkg *Package) findInstantiator(t types.Type, receiver *types.Named) (*types.Func, error) {
+	if receiver != nil {
+		var candidates []*types.Func
+		methods := types.NewMethodSet(types.NewPointer(receiver))
+		for i := 0; i < methods.Len(); i++ {
+			fn, ok := methods.At(i).Obj().(*types.Func)
+			if ok && strings.HasPrefix(fn.Name(), instantiatorPrefix) && instantiates(fn, t) {
+				candidates = append(candidates, fn)
+			}
+		}
+		if fn, err := pickInstantiator(candidates, t); fn != nil || err != nil {
+			return fn, err
+		}
+	}
+
+	scopes := []*types.Package{pkg.typesPkg}
+	if named := namedType(t); named != nil && named.Obj().Pkg() != nil && named.Obj().Pkg() != pkg.typesPkg {
+		scopes = append(scopes, named.Obj().Pkg())
+	}
+
+	for _, scope := range scopes {
+		var candidates []*types.Func
+		for _, name := range scope.Scope().Names() {
+			fn, ok := scope.Scope().Lookup(name).(*types.Func)
+			if !ok || !strings.HasPrefix(name, instantiatorPrefix) {
+				continue
+			}
+			if scope != pkg.typesPkg && !fn.Exported() {
+				continue
+			}
+			if isInstantiatorOf(fn, t) {
+				candidates = append(candidates, fn)
+			}
+		}
+		if fn, err := pickInstantiator(candidates, t); fn != nil || err != nil {
+			return fn, err
+		}
+	}
+
+	return nil, fmt.Errorf("no instantiator found for %s, expected a func like %s(r *http.Request) (%s, error)",
+		t, instantiatorName(t), types.TypeString(t, types.RelativeTo(pkg.typesPkg)))
+}
+
+// pickInstantiator returns the instantiator of t among candidates:
+// the only one or the one named after the type, nil if there is none.
+func pickInstantiator(candidates []*types.Func, t types.Type) (*types.Func, error) {
+	switch len(candidates) {
+	case 0:
+		return nil, nil
+	case 1:
+		return candidates[0], nil
+	}
+	if named := namedType(t); named != nil {
+		for _, fn := range candidates {
+			if fn.Name() == instantiatorPrefix+named.Obj().Name() {
+				return fn, nil
+			}
+		}
+	}
+	var names []string
+	for _, fn := range candidates {
+		names = append(names, fn.Name())
+	}
+	return nil, fmt.Errorf("more than one instantiator for %s: %s", t, strings.Join(names, ", "))
+}
+
+// isInstantiatorOf reports whether fn is a func with one of the signatures
+//  func(r *http.Request) (T, error)
+//  func(ctx context.Context, r *http.Request) (T, error)
+func isInstantiatorOf(fn *types.Func, t types.Type) bool {
+	return fn.Type().(*types.Signature).Recv() == nil && instantiates(fn, t)
+}
+
+// instantiates reports whether fn, a func or a method,
+// has the signature of an instantiator of t.
+func instantiates(fn *types.Func, t types.Type) bool {
+	sig := fn.Type().(*types.Signature)
+	if sig.TypeParams() != nil {
+		return false
+	}
+	params := sig.Params()
+	i := 0
+	if params.Len() > 1 && isContext(params.At(0).Type()) {
+		i++
+	}
+	if params.Len() <= i || !isHTTPRequest(params.At(i).Type()) || sig.Variadic() {
+		return false
+	}
+	for _, dep := range instantiatorDeps(fn) {
+		if isContext(dep.Type()) || isHTTPRequest(dep.Type()) {
+			return false
+		}
+	}
+	if sig.Results().Len() != 2 || !isError(sig.Results().At(1).Type()) {
+		return false
+	}
+	return types.Identical(sig.Results().At(0).Type(), t)
+}
+
+// takesContext reports whether the instantiator fn takes a context.Context.
+func takesContext(fn *types.Func) bool {
+	params := fn.Type().(*types.Signature).Params()
+	return params.Len() > 1 && isContext(params.At(0).Type())
+}
+
+// validates reports whether a variable of type t has a method
+//  Validate() error
+// or, with ctx set,
+//  Validate(ctx context.Context) error
+func validates(t types.Type) (ok, ctx bool) {
+	obj, _, _ := types.LookupFieldOrMethod(t, true, nil, "Validate")
+	fn, isFunc := obj.(*types.Func)
+	if !isFunc {
+		return false, false
+	}
+	sig := fn.Type().(*types.Signature)
+	if sig.Results().Len() != 1 || !isError(sig.Results().At(0).Type()) {
+		return false, false
+	}
+	switch {
+	case sig.Params().Len() == 0:
+		return true, false
+	case sig.Params().Len() == 1 && isContext(sig.Params().At(0).Type()):
+		return true, true
+	}
+	return false, false
+}
+
+// instantiatorDeps returns the params the instantiator fn
+// takes after the request, instantiated before it is called:
+//  func HTTPAccount(r *http.Request, uid UserID) (Account, error)
+func instantiatorDeps(fn *types.Func) []*types.Var {
+	params := fn.Type().(*types.Signature).Params()
+	i := 1
+	if takesContext(fn) {
+		i++
+	}
+	var deps []*types.Var
+	for ; i < params.Len(); i++ {
+		deps = append(deps, params.At(i))
+	}
+	return deps
+}
+
+// instantiatorName returns the conventional name of
+// the instantiator of t: HTTPX for X or *X.
+func instantiatorName(t types.Type) string {
+	if named := namedType(t); named != nil {
+		return instantiatorPrefix + named.Obj().Name()
+	}
+	return instantiatorPrefix + "X"
+}
+
+// namedType returns the named type of t or of the type t points to.
+func namedType(t types.Type) *types.Named {
+	named, _ := deref(t).(*types.Named)
+	return named
+}
+
+// isHTTPRequest reports whether t is *http.Request.
+func isHTTPRequest(t types.Type) bool {
+	p, ok := types.Unalias(t).(*types.Pointer)
+	return ok && isNamed(p.Elem(), "net/http", "Request")
+}
+
+// isContext reports whether t is context.Context.
+func isContext(t types.Type) bool {
+	return isNamed(t, "context", "Context")
+}
+
+// isError reports whether t is the error interface.
+func isError(t types.Type) bool {
+	return types.Identical(t, types.Universe.Lookup("error").Type())
+}
+
+// isNamed reports whether t is the type path.name.
+func isNamed(t types.Type, path, name string) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == path && obj.Name() == name
+}
+
+// instantiatorStatus returns the status answered to the errors
+// of the instantiator fn that don't tell theirs: its directive
+//  //varhandler:status 401
+//  func HTTPToken(r *http.Request) (Token, error)
+// or http.StatusBadRequest. Directives of instantiators
+// from other packages, that can't be read, are ignored.
+func (pkg *Package) instantiatorStatus(fn *types.Func) (int, error) {
+	decl := pkg.decls[fn]
+	if decl == nil {
+		return http.StatusBadRequest, nil
+	}
+	statuses := parseDirectives(decl.Doc)["status"]
+	switch len(statuses) {
+	case 0:
+		return http.StatusBadRequest, nil
+	case 1:
+	default:
+		return 0, fmt.Errorf("%s: more than one %sstatus", fn.Name(), directivePrefix)
+	}
+	status, err := strconv.Atoi(statuses[0])
+	if err != nil || status < 400 || status > 599 {
+		return 0, fmt.Errorf("%s: invalid %sstatus %q, expected an error status like 401", fn.Name(), directivePrefix, statuses[0])
+	}
+	return status, nil
+}
+
+// statusNames are the constants of net/http naming the error statuses.
+var statusNames = map[int]string{
+	http.StatusBadRequest:                    "http.StatusBadRequest",
+	http.StatusUnauthorized:                  "http.StatusUnauthorized",
+	http.StatusPaymentRequired:               "http.StatusPaymentRequired",
+	http.StatusForbidden:                     "http.StatusForbidden",
+	http.StatusNotFound:                      "http.StatusNotFound",
+	http.StatusMethodNotAllowed:              "http.StatusMethodNotAllowed",
+	http.StatusNotAcceptable:                 "http.StatusNotAcceptable",
+	http.StatusProxyAuthRequired:             "http.StatusProxyAuthRequired",
+	http.StatusRequestTimeout:                "http.StatusRequestTimeout",
+	http.StatusConflict:                      "http.StatusConflict",
+	http.StatusGone:                          "http.StatusGone",
+	http.StatusLengthRequired:                "http.StatusLengthRequired",
+	http.StatusPreconditionFailed:            "http.StatusPreconditionFailed",
+	http.StatusRequestEntityTooLarge:         "http.StatusRequestEntityTooLarge",
+	http.StatusRequestURITooLong:             "http.StatusRequestURITooLong",
+	http.StatusUnsupportedMediaType:          "http.StatusUnsupportedMediaType",
+	http.StatusRequestedRangeNotSatisfiable:  "http.StatusRequestedRangeNotSatisfiable",
+	http.StatusExpectationFailed:             "http.StatusExpectationFailed",
+	http.StatusTeapot:                        "http.StatusTeapot",
+	http.StatusMisdirectedRequest:            "http.StatusMisdirectedRequest",
+	http.StatusUnprocessableEntity:           "http.StatusUnprocessableEntity",
+	http.StatusLocked:                        "http.StatusLocked",
+	http.StatusFailedDependency:              "http.StatusFailedDependency",
+	http.StatusTooEarly:                      "http.StatusTooEarly",
+	http.StatusUpgradeRequired:               "http.StatusUpgradeRequired",
+	http.StatusPreconditionRequired:          "http.StatusPreconditionRequired",
+	http.StatusTooManyRequests:               "http.StatusTooManyRequests",
+	http.StatusRequestHeaderFieldsTooLarge:   "http.StatusRequestHeaderFieldsTooLarge",
+	http.StatusUnavailableForLegalReasons:    "http.StatusUnavailableForLegalReasons",
+	http.StatusInternalServerError:           "http.StatusInternalServerError",
+	http.StatusNotImplemented:                "http.StatusNotImplemented",
+	http.StatusBadGateway:                    "http.StatusBadGateway",
+	http.StatusServiceUnavailable:            "http.StatusServiceUnavailable",
+	http.StatusGatewayTimeout:                "http.StatusGatewayTimeout",
+	http.StatusHTTPVersionNotSupported:       "http.StatusHTTPVersionNotSupported",
+	http.StatusVariantAlsoNegotiates:         "http.StatusVariantAlsoNegotiates",
+	http.StatusInsufficientStorage:           "http.StatusInsufficientStorage",
+	http.StatusLoopDetected:                  "http.StatusLoopDetected",
+	http.StatusNotExtended:                   "http.StatusNotExtended",
+	http.StatusNetworkAuthenticationRequired: "http.StatusNetworkAuthenticationRequired",
+}
+
+// statusName returns the expression of status in generated code:
+// the constant of net/http naming it, like http.StatusBadRequest,
+// or the number.
+func statusName(status int) string {
+	if name, ok := statusNames[status]; ok {
+		return name
+	}
+	return strconv.Itoa(status)
+}
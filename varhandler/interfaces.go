@@ -0,0 +1,160 @@
+package main
+
+import (
+	"go/ast"
+	"go/types"
+	"log"
+	"net/http"
+	"text/template"
+)
+
+// adapterName returns the name of the http.Handler
+// generated for the interface named iface.
+func adapterName(iface string) string {
+	return iface + "Handler"
+}
+
+// generateInterface returns the definitions of the methods of the
+// interface named iface, declared in the package being generated.
+// Their handlers are methods of its adapter, embedding the interface.
+// Methods that can't be generated are logged and left empty,
+// failing the generation once they are all reported.
+func (g *Generator) generateInterface(iface string) []FuncDefinition {
+	file, it := g.pkg.findInterface(iface)
+	return g.interfaceMethods(iface, file, it)
+}
+
+// findInterface returns the declaration of the interface named name
+// and the file declaring it.
+func (pkg *Package) findInterface(name string) (*File, *ast.InterfaceType) {
+	for _, file := range pkg.files {
+		for _, decl := range file.file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts, ok := spec.(*ast.TypeSpec)
+				if !ok || ts.Name.Name != name {
+					continue
+				}
+				it, ok := ts.Type.(*ast.InterfaceType)
+				if !ok || ts.TypeParams != nil {
+					log.Fatalf("%s is not an interface", name)
+				}
+				return file, it
+			}
+		}
+	}
+	log.Fatalf("Interface not found: %s", name)
+	return nil, nil
+}
+
+// interfaceMethods returns the definitions of the methods
+// of it, and of the interfaces of the package it embeds.
+func (g *Generator) interfaceMethods(iface string, file *File, it *ast.InterfaceType) []FuncDefinition {
+	var definitions []FuncDefinition
+	for _, field := range it.Methods.List {
+		ft, ok := field.Type.(*ast.FuncType)
+		if !ok {
+			// embedded interface
+			if id, ok := field.Type.(*ast.Ident); ok {
+				embedded, eit := g.pkg.findInterface(id.Name)
+				definitions = append(definitions, g.interfaceMethods(iface, embedded, eit)...)
+				continue
+			}
+			log.Fatalf("%s: cannot serve the methods of %s: only interfaces of the package can be embedded", iface, types.ExprString(field.Type))
+		}
+		fd := FuncDefinition{
+			Name:      field.Names[0].Name,
+			Receiver:  adapterName(iface),
+			Interface: iface,
+			Doc:       field.Doc.Text(),
+		}
+		if len(ft.Params.List) == 0 {
+			log.Printf("%s should take at least one parameter, found %d instead", fd.Name, len(ft.Params.List))
+			definitions = append(definitions, FuncDefinition{})
+			continue
+		}
+		ok = fd.ParseResults(g.pkg, field.Pos(), g.pkg.signature(field.Names[0])) &&
+			fd.ParseArguments(g.pkg, file.file, ft.Params.List) &&
+			fd.ParseDirectives(g.pkg, file.file, field.Doc)
+		if !ok {
+			definitions = append(definitions, FuncDefinition{})
+			continue
+		}
+		if len(fd.Routes) == 0 {
+			fd.Routes = []string{"/" + fd.Name}
+		}
+		g.importDefinition(&fd)
+		definitions = append(definitions, fd)
+	}
+	return definitions
+}
+
+// writeAdapter generates the http.Handler serving
+// the methods of the interface named iface.
+func (g *Generator) writeAdapter(iface, outputName string, definitions []FuncDefinition) {
+	var served []FuncDefinition
+	mux := http.NewServeMux()
+	for _, fd := range definitions {
+		if fd.Interface != iface {
+			continue
+		}
+		for _, pattern := range fd.Routes {
+			if err := registerPattern(mux, pattern); err != nil {
+				log.Fatalf("%s: route %q: %s", fd.Name, pattern, err)
+			}
+		}
+		served = append(served, fd)
+	}
+
+	name := adapterName(iface)
+	for _, fd := range served {
+		if fd.Name == "ServeHTTP" {
+			log.Fatalf("%s: method ServeHTTP would be shadowed by the one of %s", iface, name)
+		}
+	}
+	for _, obj := range []types.Object{
+		g.pkg.typesPkg.Scope().Lookup(name),
+		g.pkg.typesPkg.Scope().Lookup("New" + name),
+	} {
+		if obj != nil && !sameFile(g.pkg.fset.Position(obj.Pos()).Filename, outputName) {
+			log.Fatalf("%s is already declared at %s", obj.Name(), g.pkg.fset.Position(obj.Pos()))
+		}
+	}
+
+	t := template.Must(template.New("adapter").Parse(adapterWrap))
+	err := t.Execute(&g.buf, struct {
+		Name, Interface string
+		Definitions     []FuncDefinition
+	}{name, iface, served})
+	checkError(err)
+}
+
+const adapterWrap = `
+// {{.Name}} is an http.Handler serving the methods of a {{.Interface}},
+// each at the patterns of its //varhandler:route directives,
+// or at /<Method> when it has none.
+type {{.Name}} struct {
+	{{.Interface}}
+	mux *http.ServeMux
+}
+
+// New{{.Name}} returns an http.Handler serving the methods of api.
+func New{{.Name}}(api {{.Interface}}) *{{.Name}} {
+	s := &{{.Name}}{ {{- .Interface}}: api, mux: http.NewServeMux()}
+{{- range $fd := .Definitions}}{{range .Routes}}
+{{- if $fd.Middleware}}
+	s.mux.Handle({{printf "%q" .}}, {{$fd.Wrap (printf "s.%sHandler" $fd.Name)}})
+{{- else}}
+	s.mux.HandleFunc({{printf "%q" .}}, s.{{$fd.Name}}Handler)
+{{- end}}
+{{- end}}{{end}}
+	return s
+}
+
+func (s *{{.Name}}) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+`
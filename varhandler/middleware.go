@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+)
+
+// Middleware wraps the handler of a func, in its doc:
+//  //varhandler:middleware RequireAuth,RateLimit
+// or for all the funcs, first, with -middleware.
+// It is a func or a var of type func(http.Handler) http.Handler,
+// of the package, of an imported one, or a method of the receiver.
+type Middleware struct {
+	Name string
+
+	//whether or not it is a method of the receiver of the func
+	Method bool
+
+	//Defined its from another package:
+	//name of the package in the generated code
+	Package string
+
+	//import path and declared name of the package
+	PackagePath, packageName string
+}
+
+// Expr returns the expression of m in generated code.
+func (m Middleware) Expr() string {
+	switch {
+	case m.Method:
+		return "s." + m.Name
+	case m.Package != "":
+		return m.Package + "." + m.Name
+	}
+	return m.Name
+}
+
+// Wrap returns the expression of the http.Handler serving handler,
+// a handler func of fd, wrapped by its middleware: the first
+// middleware is the outermost one.
+func (fd FuncDefinition) Wrap(handler string) string {
+	h := "http.HandlerFunc(" + handler + ")"
+	for i := len(fd.Middleware) - 1; i >= 0; i-- {
+		h = fd.Middleware[i].Expr() + "(" + h + ")"
+	}
+	return h
+}
+
+// parseMiddleware resolves the comma-separated names of middleware,
+// as seen from file, for the func fd.
+func (pkg *Package) parseMiddleware(fd *FuncDefinition, file *ast.File, names string) ([]Middleware, error) {
+	var middleware []Middleware
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		m, err := pkg.findMiddleware(fd, file, name)
+		if err != nil {
+			return nil, err
+		}
+		middleware = append(middleware, m)
+	}
+	return middleware, nil
+}
+
+// findMiddleware returns the middleware named name: a method of the
+// receiver of fd, a func or var of the package, or pkg.Name when file
+// imports pkg, any file of the package when file is nil.
+func (pkg *Package) findMiddleware(fd *FuncDefinition, file *ast.File, name string) (Middleware, error) {
+	m := Middleware{Name: name}
+	var obj types.Object
+	if qual, sel, ok := strings.Cut(name, "."); ok {
+		imported := pkg.importedAs(file, qual)
+		if imported == nil {
+			return m, fmt.Errorf("middleware %s: no package %s is imported", name, qual)
+		}
+		m.Name = sel
+		m.PackagePath, m.packageName, m.Package = imported.Path(), imported.Name(), qual
+		if obj = imported.Scope().Lookup(sel); obj != nil && !obj.Exported() {
+			obj = nil
+		}
+	} else if receiver := pkg.receiverType(fd); receiver != nil {
+		if fn, _, _ := types.LookupFieldOrMethod(types.NewPointer(receiver), true, pkg.typesPkg, name); fn != nil {
+			if _, ok := fn.(*types.Func); ok {
+				obj, m.Method = fn, true
+			}
+		}
+	}
+	if obj == nil && m.PackagePath == "" {
+		obj = pkg.typesPkg.Scope().Lookup(name)
+	}
+	switch obj.(type) {
+	case *types.Func, *types.Var:
+	default:
+		return m, fmt.Errorf("middleware %s: no func or var %s found", name, name)
+	}
+	if !isMiddleware(obj.Type()) {
+		return m, fmt.Errorf("middleware %s is a %s, expected a func(http.Handler) http.Handler", name, obj.Type())
+	}
+	return m, nil
+}
+
+// importedAs returns the package file imports as name,
+// looking at every file of the package when file is nil.
+func (pkg *Package) importedAs(file *ast.File, name string) *types.Package {
+	files := []*ast.File{file}
+	if file == nil {
+		files = nil
+		for _, f := range pkg.files {
+			files = append(files, f.file)
+		}
+	}
+	for _, file := range files {
+		for _, spec := range file.Imports {
+			obj := pkg.info.Implicits[spec]
+			if spec.Name != nil {
+				obj = pkg.info.Defs[spec.Name]
+			}
+			if pkgName, ok := obj.(*types.PkgName); ok && pkgName.Name() == name {
+				return pkgName.Imported()
+			}
+		}
+	}
+	return nil
+}
+
+// isMiddleware reports whether t is a func(http.Handler) http.Handler.
+func isMiddleware(t types.Type) bool {
+	sig, ok := t.Underlying().(*types.Signature)
+	return ok && sig.TypeParams() == nil && !sig.Variadic() &&
+		sig.Params().Len() == 1 && isNamed(sig.Params().At(0).Type(), "net/http", "Handler") &&
+		sig.Results().Len() == 1 && isNamed(sig.Results().At(0).Type(), "net/http", "Handler")
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/types"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// openAPIVersion is the version of the OpenAPI specification
+// the documents written with -openapi follow.
+const openAPIVersion = "3.1.0"
+
+// OpenAPI document, limited to what varhandler can tell.
+// Maps are used for keys that vary, so that encoding/json
+// sorts them and documents are reproducible.
+type openAPIDoc struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       openAPIInfo                      `json:"info"`
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components *components                      `json:"components,omitempty"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type components struct {
+	Schemas map[string]*schema `json:"schemas"`
+}
+
+type operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Parameters  []parameter          `json:"parameters,omitempty"`
+	RequestBody *requestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*response `json:"responses"`
+}
+
+type parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Content map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema,omitempty"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	ContentEncoding      string             `json:"contentEncoding,omitempty"`
+	ContentMediaType     string             `json:"contentMediaType,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+}
+
+// writeOpenAPI writes to path the OpenAPI document
+// of the definitions that have routes. Two routes documented
+// as the same operation fail the generation.
+func (g *Generator) writeOpenAPI(path string, definitions []FuncDefinition) {
+	doc := openAPIDoc{
+		OpenAPI: openAPIVersion,
+		Info:    openAPIInfo{Title: g.pkg.name, Version: "0.0.0"},
+		Paths:   make(map[string]map[string]*operation),
+	}
+	schemas := &schemaBuilder{components: make(map[string]*schema), names: make(map[string]types.Type)}
+	routes := make(map[string]string) // of the operations, by method and path
+	for _, fd := range definitions {
+		if fd.Name == "" {
+			continue
+		}
+		if len(fd.Routes) == 0 {
+			log.Printf("%s has no route, it is left out of %s", fd.Name, path)
+			continue
+		}
+		for i, pattern := range fd.Routes {
+			method, route := openAPIPath(pattern)
+			key := strings.ToUpper(method) + " " + route
+			if other, ok := routes[key]; ok {
+				log.Fatalf("%s: route %q is documented as %s, like %s", fd.Name, pattern, key, other)
+			}
+			routes[key] = fmt.Sprintf("route %q of %s", pattern, fd.Name)
+			op := fd.operation(schemas, pattern)
+			if i > 0 {
+				op.OperationID = fmt.Sprintf("%s%d", fd.Name, i+1)
+			}
+			if doc.Paths[route] == nil {
+				doc.Paths[route] = make(map[string]*operation)
+			}
+			doc.Paths[route][method] = op
+		}
+	}
+	if len(schemas.components) > 0 {
+		doc.Components = &components{Schemas: schemas.components}
+	}
+
+	b, err := json.MarshalIndent(doc, "", "  ")
+	checkError(err)
+	if err := ioutil.WriteFile(path, append(b, '\n'), 0644); err != nil {
+		log.Fatalf("writing openapi: %s", err)
+	}
+}
+
+// openAPIPath returns the lower cased method and the OpenAPI path
+// of a http.ServeMux pattern. The host is dropped, as are {$}
+// and the dots of {name...}. Patterns without a method,
+// matching any, are documented as get.
+func openAPIPath(pattern string) (method, path string) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		method, path = http.MethodGet, pattern
+	}
+	path = strings.TrimSpace(path)
+	if i := strings.Index(path, "/"); i > 0 {
+		path = path[i:] // host
+	}
+	path = strings.TrimSuffix(path, "{$}")
+	path = strings.Replace(path, "...}", "}", -1)
+	return strings.ToLower(method), path
+}
+
+// operation documents the handler of fd served with pattern.
+func (fd FuncDefinition) operation(schemas *schemaBuilder, pattern string) *operation {
+	op := &operation{
+		OperationID: fd.Name,
+		Responses:   make(map[string]*response),
+	}
+	if doc := strings.TrimSpace(fd.Doc); doc != "" {
+		summary, description, _ := strings.Cut(doc, "\n")
+		op.Summary = summary
+		op.Description = strings.TrimSpace(description)
+	}
+
+	var path, other []Binding
+	for _, param := range fd.Instantiations {
+		for _, input := range param.RequestInputs() {
+			if input.In == "path" {
+				path = append(path, input)
+			} else {
+				other = append(other, input)
+			}
+		}
+	}
+	wildcards, _ := checkRoute(pattern) // checked by ParseDirectives
+	for _, wildcard := range wildcards {
+		p := parameter{Name: wildcard, In: "path", Required: true, Schema: &schema{Type: "string"}}
+		for _, input := range path {
+			if input.Name == wildcard {
+				p.Schema = schemas.text(input.Type)
+			}
+		}
+		op.Parameters = append(op.Parameters, p)
+	}
+
+	form := &schema{Type: "object", Properties: make(map[string]*schema)}
+	formType := "application/x-www-form-urlencoded"
+	for _, input := range other {
+		switch input.In {
+		case "body":
+			if op.RequestBody == nil {
+				op.RequestBody = &requestBody{Content: make(map[string]mediaType)}
+			}
+			op.RequestBody.Content[codecMediaTypes[input.Name]] = mediaType{Schema: schemas.of(input.Type)}
+		case "form":
+			form.Properties[input.Name] = schemas.text(input.Type)
+		case "file":
+			file := &schema{Type: "string", ContentMediaType: "application/octet-stream"}
+			if input.Setter == "SetFormFiles" {
+				file = &schema{Type: "array", Items: file}
+			}
+			form.Properties[input.Name] = file
+			formType = "multipart/form-data"
+		default:
+			op.Parameters = append(op.Parameters, parameter{Name: input.Name, In: input.In, Schema: schemas.text(input.Type)})
+		}
+	}
+	if len(form.Properties) > 0 {
+		if op.RequestBody == nil {
+			op.RequestBody = &requestBody{Content: make(map[string]mediaType)}
+		}
+		op.RequestBody.Content[formType] = mediaType{Schema: form}
+	}
+
+	ok := &response{Description: http.StatusText(http.StatusOK)}
+	if fd.Response {
+		ok.Content = fd.responseContent(schemas)
+	}
+	if fd.Status {
+		ok.Description = "Success"
+		op.Responses["2XX"] = ok
+	} else {
+		op.Responses["200"] = ok
+	}
+	problem := map[string]mediaType{"application/problem+json": {Schema: schemas.problemSchema()}}
+	for _, param := range fd.Instantiations {
+		op.Responses[strconv.Itoa(param.ErrorStatus)] = &response{Description: http.StatusText(param.ErrorStatus), Content: problem}
+		if param.Validate {
+			op.Responses["422"] = &response{Description: http.StatusText(http.StatusUnprocessableEntity), Content: problem}
+		}
+	}
+	if fd.MaxBody > 0 {
+		op.Responses["413"] = &response{Description: http.StatusText(http.StatusRequestEntityTooLarge), Content: problem}
+	}
+	op.Responses["500"] = &response{Description: http.StatusText(http.StatusInternalServerError), Content: problem}
+	return op
+}
+
+// responseContent returns the content of the response of fd:
+// the media type of its codec or what HandleHTTPResponse writes,
+// nil when it can't be told, for an http.Handler or an interface.
+// The values of a stream are told one per line, or as events.
+func (fd FuncDefinition) responseContent(schemas *schemaBuilder) map[string]mediaType {
+	t := fd.ResponseType
+	if elem := streamElem(t); elem != nil {
+		return map[string]mediaType{
+			"application/x-ndjson": {Schema: schemas.of(elem)},
+			"text/event-stream":    {Schema: &schema{Type: "string"}},
+		}
+	}
+	switch {
+	case hasMethod(t, "ServeHTTP"):
+		return nil
+	case isReader(t):
+		return map[string]mediaType{"application/octet-stream": {}}
+	case types.IsInterface(t):
+		return nil
+	case hasMethod(t, "Bytes"), types.Identical(t.Underlying(), types.NewSlice(types.Typ[types.Byte])):
+		return map[string]mediaType{"application/octet-stream": {}}
+	case hasMethod(t, "String"):
+		return map[string]mediaType{"text/plain": {Schema: &schema{Type: "string"}}}
+	case fd.Codec == "gob":
+		return map[string]mediaType{codecMediaTypes[fd.Codec]: {}}
+	}
+	return map[string]mediaType{codecMediaTypes[fd.Codec]: {Schema: schemas.of(t)}}
+}
+
+// hasMethod reports whether t has a method named name.
+func hasMethod(t types.Type, name string) bool {
+	obj, _, _ := types.LookupFieldOrMethod(t, false, nil, name)
+	_, ok := obj.(*types.Func)
+	return ok
+}
+
+// schemaBuilder builds the schemas of Go types, as encoded by
+// encoding/json. Named structs are put into components and referred to.
+type schemaBuilder struct {
+	components map[string]*schema
+	names      map[string]types.Type // types of the components, by name
+	problem    string                // name of the Problem component, once added
+}
+
+// text returns the schema of a value of type t read from a string
+// of the request, as a generated instantiator would set it.
+func (s *schemaBuilder) text(t types.Type) *schema {
+	switch {
+	case isNamed(t, "time", "Time"):
+		return &schema{Type: "string", Format: "date-time"}
+	case isNamed(t, "time", "Duration"), isTextUnmarshaler(types.NewPointer(t)):
+		return &schema{Type: "string"}
+	}
+	return s.of(t)
+}
+
+// of returns the schema of t.
+func (s *schemaBuilder) of(t types.Type) *schema {
+	t = types.Unalias(t)
+	switch {
+	case isNamed(t, "time", "Time"):
+		return &schema{Type: "string", Format: "date-time"}
+	case hasMethod(t, "MarshalJSON"):
+		return &schema{}
+	case hasMethod(t, "MarshalText"):
+		return &schema{Type: "string"}
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		return basicSchema(u)
+	case *types.Pointer:
+		return s.of(u.Elem())
+	case *types.Slice:
+		if isByte(u.Elem()) {
+			return &schema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &schema{Type: "array", Items: s.of(u.Elem())}
+	case *types.Array:
+		return &schema{Type: "array", Items: s.of(u.Elem())}
+	case *types.Map:
+		return &schema{Type: "object", AdditionalProperties: s.of(u.Elem())}
+	case *types.Struct:
+		named, ok := t.(*types.Named)
+		if !ok {
+			return s.object(u)
+		}
+		return &schema{Ref: "#/components/schemas/" + s.component(named, u)}
+	}
+	return &schema{} // interfaces, anything
+}
+
+// problemSchema returns the schema of the Problem of error responses,
+// named apart from the types of the package, like they are named apart.
+func (s *schemaBuilder) problemSchema() *schema {
+	if s.problem == "" {
+		s.problem = "Problem"
+		for i := 2; ; i++ {
+			if _, ok := s.names[s.problem]; !ok {
+				break
+			}
+			s.problem = fmt.Sprintf("Problem%d", i)
+		}
+		s.names[s.problem] = nil // not a type of the package
+		str := &schema{Type: "string"}
+		s.components[s.problem] = &schema{Type: "object", Properties: map[string]*schema{
+			"type":     str,
+			"title":    str,
+			"status":   {Type: "integer", Format: "int64"},
+			"detail":   str,
+			"instance": str,
+			"invalid-params": {Type: "array", Items: &schema{Type: "object", Properties: map[string]*schema{
+				"name":   str,
+				"reason": str,
+			}}},
+		}}
+	}
+	return &schema{Ref: "#/components/schemas/" + s.problem}
+}
+
+// component adds the schema of the named struct t to the
+// components, if not done already, and returns its name.
+func (s *schemaBuilder) component(t *types.Named, st *types.Struct) string {
+	base := t.Obj().Name()
+	if t.TypeArgs().Len() > 0 {
+		for i := 0; i < t.TypeArgs().Len(); i++ {
+			base += "_" + typeName(t.TypeArgs().At(i))
+		}
+	}
+	name := base
+	for i := 2; ; i++ {
+		seen, ok := s.names[name]
+		if !ok {
+			break
+		}
+		if types.Identical(seen, t) {
+			return name
+		}
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	s.names[name] = t
+	s.components[name] = &schema{} // allows recursive types
+	*s.components[name] = *s.object(st)
+	return name
+}
+
+// object returns the schema of the fields of st
+// that encoding/json encodes.
+func (s *schemaBuilder) object(st *types.Struct) *schema {
+	obj := &schema{Type: "object", Properties: make(map[string]*schema)}
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		tag := reflect.StructTag(st.Tag(i)).Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" && !strings.HasPrefix(tag, "-,") {
+			continue
+		}
+		if field.Embedded() && name == "" {
+			if embedded, ok := deref(field.Type()).Underlying().(*types.Struct); ok {
+				for name, prop := range s.object(embedded).Properties {
+					if _, ok := obj.Properties[name]; !ok {
+						obj.Properties[name] = prop
+					}
+				}
+				continue
+			}
+		}
+		if !field.Exported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name()
+		}
+		obj.Properties[name] = s.of(field.Type())
+	}
+	return obj
+}
+
+// basicSchema returns the schema of a basic type.
+func basicSchema(b *types.Basic) *schema {
+	info := b.Info()
+	switch {
+	case info&types.IsBoolean != 0:
+		return &schema{Type: "boolean"}
+	case info&types.IsInteger != 0:
+		switch b.Kind() {
+		case types.Int32, types.Uint32, types.Int16, types.Uint16, types.Int8, types.Uint8:
+			return &schema{Type: "integer", Format: "int32"}
+		}
+		return &schema{Type: "integer", Format: "int64"}
+	case info&types.IsFloat != 0:
+		if b.Kind() == types.Float32 {
+			return &schema{Type: "number", Format: "float"}
+		}
+		return &schema{Type: "number", Format: "double"}
+	case info&types.IsString != 0:
+		return &schema{Type: "string"}
+	}
+	return &schema{}
+}
+
+// typeName returns a name for t usable in a component name.
+func typeName(t types.Type) string {
+	name := types.TypeString(t, func(*types.Package) string { return "" })
+	return strings.Map(func(r rune) rune {
+		if r == '_' || 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func isByte(t types.Type) bool {
+	b, ok := types.Unalias(t).(*types.Basic)
+	return ok && b.Kind() == types.Byte
+}
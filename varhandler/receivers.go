@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// routesName is the name of the method returning
+// the routes of the handlers generated for a receiver.
+const routesName = "Routes"
+
+// funcRef names a func, or a method along with its receiver type:
+//  GetUser
+//  (*UserService).GetUser
+//  (UserService).GetUser
+// Handlers of methods always have a pointer receiver.
+type funcRef struct {
+	Receiver string // name of the receiver type, "" for a func
+	Name     string
+}
+
+func (ref funcRef) String() string {
+	if ref.Receiver == "" {
+		return ref.Name
+	}
+	return fmt.Sprintf("(*%s).%s", ref.Receiver, ref.Name)
+}
+
+// parseFuncRef parses a name of -func, receiver
+// being the receiver of the names without one.
+func parseFuncRef(s, receiver string) (funcRef, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "(") {
+		return funcRef{Receiver: receiver, Name: s}, nil
+	}
+	recv, name, ok := strings.Cut(s[1:], ").")
+	recv = strings.TrimPrefix(recv, "*")
+	if !ok || !isIdent(recv) || !isIdent(name) {
+		return funcRef{}, fmt.Errorf("invalid method %q, expected (*T).Method", s)
+	}
+	return funcRef{Receiver: recv, Name: name}, nil
+}
+
+func isIdent(s string) bool {
+	return s != "" && !strings.ContainsAny(s, "()*. ")
+}
+
+// receiverName returns the name of the type of the receiver of decl,
+// "" if decl is not a method or a method of a generic type.
+func receiverName(decl *ast.FuncDecl) string {
+	if decl.Recv == nil || len(decl.Recv.List) != 1 {
+		return ""
+	}
+	expr := decl.Recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if id, ok := expr.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// routedMethods returns the methods of receiver that
+// have a //varhandler:route, in the order they are declared.
+func (pkg *Package) routedMethods(receiver string) []funcRef {
+	var refs []funcRef
+	for _, file := range pkg.files {
+		for _, decl := range file.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if ok && receiverName(fn) == receiver && len(parseDirectives(fn.Doc)["route"]) > 0 {
+				refs = append(refs, funcRef{Receiver: receiver, Name: fn.Name.Name})
+			}
+		}
+	}
+	return refs
+}
+
+// receiverType returns the named type of the receiver of fd.
+func (pkg *Package) receiverType(fd *FuncDefinition) *types.Named {
+	if fd.Receiver == "" || fd.Interface != "" {
+		return nil
+	}
+	obj, _ := pkg.typesPkg.Scope().Lookup(fd.Receiver).(*types.TypeName)
+	if obj == nil {
+		return nil
+	}
+	named, _ := types.Unalias(obj.Type()).(*types.Named)
+	return named
+}
+
+// writeRoutes generates, for each receiver of the definitions,
+// the method returning the routes of its handlers.
+func (g *Generator) writeRoutes(outputName string, definitions []FuncDefinition) {
+	var receivers []string
+	routes := make(map[string][]FuncDefinition)
+	for _, fd := range definitions {
+		if fd.Receiver == "" || fd.Interface != "" || len(fd.Routes) == 0 {
+			continue
+		}
+		if routes[fd.Receiver] == nil {
+			receivers = append(receivers, fd.Receiver)
+		}
+		routes[fd.Receiver] = append(routes[fd.Receiver], fd)
+	}
+
+	t := template.Must(template.New("routes").Funcs(template.FuncMap{"Helper": g.helper}).Parse(routesWrap))
+	for _, receiver := range receivers {
+		mux := http.NewServeMux()
+		for _, fd := range routes[receiver] {
+			for _, pattern := range fd.Routes {
+				if err := registerPattern(mux, pattern); err != nil {
+					log.Fatalf("%s: route %q: %s", fd.Name, pattern, err)
+				}
+			}
+		}
+		named := g.pkg.receiverType(&routes[receiver][0])
+		obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(named), true, g.pkg.typesPkg, routesName)
+		if obj != nil && !sameFile(g.pkg.fset.Position(obj.Pos()).Filename, outputName) {
+			log.Fatalf("%s already has a %s at %s", receiver, routesName, g.pkg.fset.Position(obj.Pos()))
+		}
+		err := t.Execute(&g.buf, struct {
+			Name, Receiver string
+			Definitions    []FuncDefinition
+		}{routesName, receiver, routes[receiver]})
+		checkError(err)
+	}
+}
+
+const routesWrap = `
+// {{.Name}} returns the generated handlers of s, wrapped by their
+// middleware, with the patterns of their //varhandler:route directives,
+// see {{Helper "HandleRoutes"}}.
+func (s *{{.Receiver}}) {{.Name}}() []{{Helper "Route"}} {
+	return []{{Helper "Route"}}{
+{{- range $fd := .Definitions}}{{range .Routes}}
+		{Pattern: {{printf "%q" .}}, Handler: {{$fd.Wrap (printf "s.%sHandler" $fd.Name)}}},
+{{- end}}{{end}}
+	}
+}
+`
@@ -3,9 +3,11 @@ package main
 import (
 	"fmt"
 	"go/ast"
+	"go/token"
+	"go/types"
 	"log"
-
-	_ "go/importer"
+	"net/http"
+	"strings"
 )
 
 //FuncDefinition represents
@@ -14,91 +16,491 @@ import (
 type FuncDefinition struct {
 	Name string // of the function
 
+	//Receiver is the type the function is a method of, "" for a func;
+	//its handler is then a method of *Receiver
+	Receiver string
+
+	//Interface is the interface the function is a method of, "" otherwise;
+	//Receiver is then the adapter embedding it
+	Interface string
+
+	Doc string // of the function, directives excluded
+
 	//wether or not a status is returned by the handler
 	Status bool
 
+	//type of the status, if any: int or a named integer type
+	StatusType types.Type
+
+	//whether or not an http.Header is returned by the handler,
+	//set on the response
+	Header bool
+
 	//wether or not a response is returned by the handler
 	Response bool
 
-	//params the functions take
+	//type of the response, if any
+	ResponseType types.Type
+
+	//vars the results are assigned to in the generated code, in order:
+	//resp, status, header and err
+	Results []string
+
+	//codec encoding the response when HandleHTTPResponse can't,
+	//set with -codec or
+	//  //varhandler:codec xml
+	Codec string
+
+	//whether or not the first param is a context.Context,
+	//in which case the request's context is passed
+	Context bool
+
+	//params the functions take, context excluded
 	Params []Param
+
+	//params to instantiate, in the order their generators are called:
+	//the params of the function and the params their generators take,
+	//each instantiated once
+	Instantiations []Param
+
+	//http.ServeMux patterns of the handler, set with
+	//  //varhandler:route GET /users/{id}
+	Routes []string
+
+	//middleware wrapping the handler when it is registered, the ones
+	//of -middleware then the ones set with
+	//  //varhandler:middleware RequireAuth,RateLimit
+	Middleware []Middleware
+
+	//size in bytes the body of requests is limited to, 0 for no limit,
+	//set with
+	//  //varhandler:maxbody 1MB
+	MaxBody int64
 }
 
 type Param struct {
 	//Name used inside the function
 	Name string
 
+	//Var holding the param in the generated code
+	Var string
+
+	//Arg is the name of the param in the func,
+	//Var when it has none
+	Arg string
+
+	//Type of the param, as resolved by the type checker
+	Type types.Type
+
 	//the name of the func that will generate our param
 	GeneratorName string
 
-	//Defined its a param from another package
+	//whether or not the generator is a method of the receiver of the func
+	Method bool
+
+	//whether or not the generator takes a context.Context
+	Context bool
+
+	//Vars of the params the generator takes after the request
+	Deps []string
+
+	//whether or not the param has a method
+	//  Validate() error
+	//or, with ValidateContext,
+	//  Validate(ctx context.Context) error
+	//called once it is instantiated
+	Validate, ValidateContext bool
+
+	//status answered to the errors of the generator that don't tell theirs,
+	//http.StatusBadRequest unless set with
+	//  //varhandler:status 401
+	ErrorStatus int
+
+	//Defined its a param from another package:
+	//name of the package in the generated code
 	Package string
+
+	//import path and declared name of the package
+	PackagePath, packageName string
+
+	//fields set from the request when there is no
+	//generator and the param is a struct with tagged fields
+	Bindings []Binding
+
+	//whether or not a json body of the bindings is decoded strictly,
+	//rejecting unknown fields and trailing data, set for the func with
+	//  //varhandler:strict
+	Strict bool
+
+	//values of the request the generator reads, as far as can be
+	//told from its code, without field and typed as read
+	Inputs []Binding
 }
 
-func (fd *FuncDefinition) ParseResults(results *ast.FieldList) bool {
-	if results == nil || len(results.List) == 0 {
-		log.Printf("%s should at least return an error", fd.Name)
-		return false
+//instantiation returns the instantiated param held by v
+func (fd FuncDefinition) instantiation(v string) Param {
+	for _, param := range fd.Instantiations {
+		if param.Var == v {
+			return param
+		}
 	}
-	if len(results.List) == 1 {
-		return true
+	return Param{}
+}
+
+//File returns the name of the form field of a param that is a file
+//of the multipart form, as a whole, "" for any other param
+func (p Param) File() string {
+	if len(p.Bindings) == 1 && p.Bindings[0].In == "file" && p.Bindings[0].Field == "" {
+		return p.Bindings[0].Name
 	}
-	if len(results.List) == 2 {
-		v, ok := results.List[0].Type.(*ast.Ident)
-		if ok && v.Name == "int" {
-			fd.Status = true
-		} else {
-			fd.Response = true
+	return ""
+}
+
+//Multipart tells whether the param is set from files of the multipart
+//form, parsed first for its memory limit to apply to its form values too
+func (p Param) Multipart() bool {
+	for _, b := range p.Bindings {
+		if b.In == "file" {
+			return true
 		}
-		return true
 	}
+	return false
+}
 
-	if len(results.List) == 3 {
-		fd.Status = true
-		fd.Response = true
-		return true
+//Multipart tells whether a param of the func is set from the files
+//of the multipart form, removed once the handler returns
+func (fd FuncDefinition) Multipart() bool {
+	for _, param := range fd.Instantiations {
+		if param.Multipart() {
+			return true
+		}
 	}
-
-	log.Printf("too many results for %s", fd.Name)
 	return false
 }
 
-func (fd *FuncDefinition) ParseArguments(arguments []*ast.Field) bool {
-	generatorNameSuffix := "HTTP"
-	for _, argument := range arguments {
-		switch v := argument.Type.(type) { // get var type
-		case *ast.Ident:
-			// plain type like `x X` from `type x struct {}`
-			fd.Params = append(fd.Params, Param{
-				Name:          v.Name,
-				GeneratorName: generatorNameSuffix + v.Name,
-			})
-		case *ast.StarExpr:
-			// arg like `x *X`
-			vv, ok := v.X.(*ast.Ident)
-			if !ok {
-				log.Printf("Found an unary star")
+//Pointer tells whether the param is a pointer
+func (p Param) Pointer() bool {
+	_, ok := types.Unalias(p.Type).(*types.Pointer)
+	return ok
+}
+
+//RequestInputs returns the values of the request the param is made of
+func (p Param) RequestInputs() []Binding {
+	if p.Bindings != nil {
+		return p.Bindings
+	}
+	return p.Inputs
+}
+
+//Elem returns the type the param points to, or its type
+func (p Param) Elem() types.Type {
+	return deref(p.Type)
+}
+
+//ParseResults classifies the results of the func, of signature sig
+//declared at pos, by type: an error last and before it, in any order,
+//at most one of each
+//  status   int, or a named integer type like type Status int
+//  header   http.Header
+//  response any other type
+//Mismatches are reported with their position.
+func (fd *FuncDefinition) ParseResults(pkg *Package, pos token.Pos, sig *types.Signature) bool {
+	results := sig.Results()
+	if results.Len() == 0 || !isError(results.At(results.Len()-1).Type()) {
+		log.Printf("%s: %s should return an error last", pkg.fset.Position(pos), fd.Name)
+		return false
+	}
+	for i := 0; i < results.Len()-1; i++ {
+		result := results.At(i)
+		at := pos
+		if result.Pos().IsValid() {
+			at = result.Pos()
+		}
+		t := result.Type()
+		var kind string
+		switch {
+		case isError(t):
+			log.Printf("%s: %s: only the last result can be an error", pkg.fset.Position(at), fd.Name)
+			return false
+		case isStatus(t):
+			kind = "status"
+			if !fd.Status {
+				fd.Status, fd.StatusType = true, t
+				fd.Results = append(fd.Results, kind)
+				continue
+			}
+		case isNamed(t, "net/http", "Header"):
+			kind = "header"
+			if !fd.Header {
+				fd.Header = true
+				fd.Results = append(fd.Results, kind)
+				continue
+			}
+		default:
+			kind = "response"
+			if !fd.Response {
+				fd.Response, fd.ResponseType = true, t
+				fd.Results = append(fd.Results, "resp")
+				continue
+			}
+		}
+		log.Printf("%s: %s returns more than one %s, a %s", pkg.fset.Position(at), fd.Name, kind, types.TypeString(t, types.RelativeTo(pkg.typesPkg)))
+		return false
+	}
+	fd.Results = append(fd.Results, "err")
+	return true
+}
+
+//StatusInt returns the status result as an int in generated code.
+func (fd FuncDefinition) StatusInt() string {
+	if types.Identical(fd.StatusType, types.Typ[types.Int]) {
+		return "status"
+	}
+	return "int(status)"
+}
+
+//isStatus reports whether a result of type t is a status:
+//an int, or a named type of integer kind.
+func isStatus(t types.Type) bool {
+	basic, ok := t.Underlying().(*types.Basic)
+	if !ok || basic.Info()&types.IsInteger == 0 {
+		return false
+	}
+	_, named := types.Unalias(t).(*types.Named)
+	return named || basic.Kind() == types.Int
+}
+
+//ParseArguments resolves the type of each argument
+//and the params to instantiate for it, see instantiate.
+func (fd *FuncDefinition) ParseArguments(pkg *Package, file *ast.File, arguments []*ast.Field) bool {
+	for i, argument := range arguments {
+		t := pkg.info.TypeOf(argument.Type)
+		if t == nil || t == types.Typ[types.Invalid] {
+			log.Printf("%s: could not resolve type of %s", fd.Name, types.ExprString(argument.Type))
+			return false
+		}
+		if i == 0 && len(argument.Names) <= 1 && isContext(t) {
+			fd.Context = true
+			continue
+		}
+		// `a, b X` declares two params of the same type,
+		// instantiated once unless they are files of the form
+		for i := 0; i < len(argument.Names) || i == 0; i++ {
+			arg := ""
+			if i < len(argument.Names) && argument.Names[i].Name != "_" {
+				arg = argument.Names[i].Name
+			}
+			param, err := fd.instantiate(pkg, file, t, argument.Type, arg, nil)
+			if err != nil {
+				log.Printf("%s: %s", fd.Name, err)
 				return false
 			}
-			fd.Params = append(fd.Params, Param{
-				Name:          vv.Name,
-				GeneratorName: generatorNameSuffix + vv.Name,
-			})
-		case *ast.SelectorExpr:
-			// arg like `x pkgname.X`
-			pkg, ok := v.X.(fmt.Stringer)
-			if !ok {
-				log.Printf("could not define type of %#v", v)
-			}
-			fd.Params = append(fd.Params, Param{
-				Name:          v.Sel.String(),
-				GeneratorName: generatorNameSuffix + v.Sel.String(),
-				Package:       pkg.String(),
-			})
+			param.Arg = param.Var
+			if arg != "" {
+				param.Arg = arg
+			}
+			fd.Params = append(fd.Params, param)
+		}
+	}
+	return true
+}
+
+//instantiate returns the param of type t, expr in file, adding it to
+//the instantiations after the params its generator takes, unless a
+//param of that type is already instantiated: each generator is called
+//once. arg names the param, needed are the params being instantiated
+//that need it, to report cycles and missing generators.
+//Files of the multipart form are told apart by arg, see fileSetter.
+func (fd *FuncDefinition) instantiate(pkg *Package, file *ast.File, t types.Type, expr ast.Expr, arg string, needed []Param) (Param, error) {
+	for _, param := range fd.Instantiations {
+		if types.Identical(param.Type, t) && (param.File() == "" || param.File() == arg) {
+			return param, nil
+		}
+	}
+	param := Param{
+		Name: types.TypeString(t, types.RelativeTo(pkg.typesPkg)),
+		Type: t,
+	}
+	for i, need := range needed {
+		if types.Identical(need.Type, t) {
+			var cycle []string
+			for _, need := range needed[i:] {
+				cycle = append(cycle, fmt.Sprintf("%s (%s)", need.Name, need.GeneratorName))
+			}
+			return param, fmt.Errorf("instantiator cycle: %s -> %s", strings.Join(cycle, " -> "), param.Name)
+		}
+	}
+	instantiator, err := pkg.findInstantiator(t, pkg.receiverType(fd))
+	if err == nil {
+		param.GeneratorName = instantiator.Name()
+		param.Context = takesContext(instantiator)
+		param.Inputs = pkg.instantiatorInputs(instantiator)
+		param.Method = instantiator.Type().(*types.Signature).Recv() != nil
+		if param.ErrorStatus, err = pkg.instantiatorStatus(instantiator); err != nil {
+			return param, err
+		}
+		if instantiator.Pkg() != pkg.typesPkg {
+			param.PackagePath = instantiator.Pkg().Path()
+			param.packageName = instantiator.Pkg().Name()
+			if expr != nil { // the param of an instantiator has no alias
+				param.Package = pkg.importName(file, expr, param.PackagePath)
+			}
+		}
+		for _, dep := range instantiatorDeps(instantiator) {
+			p, err := fd.instantiate(pkg, file, dep.Type(), nil, dep.Name(), append(needed, param))
+			if err != nil {
+				return param, err
+			}
+			param.Deps = append(param.Deps, p.Var)
+		}
+	} else {
+		// no instantiator: maybe one can be generated from struct tags,
+		// or the param is a file of the form named after arg
+		bindings, berr := pkg.parseBindings(t)
+		if setter := fileSetter(t); setter != "" {
+			bindings = []Binding{{In: "file", Name: arg, Type: t, Setter: setter}}
+			if arg == "" || arg == "_" {
+				berr = fmt.Errorf("a file must be named after its form field")
+			}
+		}
+		if berr != nil {
+			err = fmt.Errorf("cannot instantiate %s: %s", param.Name, berr)
+		}
+		if berr != nil || len(bindings) == 0 {
+			if len(needed) > 0 {
+				err = fmt.Errorf("%s takes a %s: %s", needed[len(needed)-1].GeneratorName, param.Name, err)
+			}
+			return param, err
+		}
+		param.Bindings = bindings
+		param.ErrorStatus = http.StatusBadRequest
+	}
+	param.Validate, param.ValidateContext = validates(t)
+	param.Var = fmt.Sprintf("param%d", len(fd.Instantiations))
+	param.Arg = arg
+	if arg == "" || arg == "_" {
+		param.Arg = param.Var
+	}
+	fd.Instantiations = append(fd.Instantiations, param)
+	return param, nil
+}
+
+//ParseDirectives reads the //varhandler: directives of the func's doc,
+//declared in file.
+//It must be called once the arguments are parsed.
+func (fd *FuncDefinition) ParseDirectives(pkg *Package, file *ast.File, doc *ast.CommentGroup) bool {
+	fd.Codec = pkg.codec
+	middleware, err := pkg.parseMiddleware(fd, nil, pkg.middleware)
+	if err != nil {
+		log.Printf("%s: -middleware: %s", fd.Name, err)
+		return false
+	}
+	fd.Middleware = middleware
+	for name, args := range parseDirectives(doc) {
+		switch name {
+		case "codec":
+			if len(args) != 1 || !contains(codecs, args[0]) {
+				log.Printf("%s: %scodec takes one of %v", fd.Name, directivePrefix, codecs)
+				return false
+			}
+			fd.Codec = args[0]
+		case "route":
+			for _, pattern := range args {
+				wildcards, err := checkRoute(pattern)
+				if err != nil {
+					log.Printf("%s: invalid route %q: %s", fd.Name, pattern, err)
+					return false
+				}
+				if !fd.checkPathBindings(pattern, wildcards) {
+					return false
+				}
+				fd.Routes = append(fd.Routes, pattern)
+			}
+		case "middleware":
+			for _, names := range args {
+				middleware, err := pkg.parseMiddleware(fd, file, names)
+				if err != nil {
+					log.Printf("%s: %s", fd.Name, err)
+					return false
+				}
+				fd.Middleware = append(fd.Middleware, middleware...)
+			}
+		case "maxbody":
+			size, err := int64(0), fmt.Errorf("takes one size")
+			if len(args) == 1 {
+				size, err = parseSize(args[0])
+			}
+			if err != nil {
+				log.Printf("%s: %smaxbody: %s, like 512KB or 1MB", fd.Name, directivePrefix, err)
+				return false
+			}
+			fd.MaxBody = size
+		case "strict":
+			for _, arg := range args {
+				if arg != "" {
+					log.Printf("%s: %sstrict takes no argument", fd.Name, directivePrefix)
+					return false
+				}
+			}
+			for i, param := range fd.Instantiations {
+				for _, b := range param.Bindings {
+					if b.In == "body" && b.Name != "json" {
+						log.Printf("%s: %sstrict only decodes json bodies, field %s of %s is %s", fd.Name, directivePrefix, b.Field, param.Name, b.Name)
+						return false
+					}
+				}
+				fd.Instantiations[i].Strict = true
+			}
 		default:
-			log.Printf("Could not guess var full name, type not expected: %#v", v)
+			log.Printf("%s: unknown directive %s%s", fd.Name, directivePrefix, name)
+			return false
+		}
+	}
+	return fd.checkResponse()
+}
+
+//checkResponse checks that the response, if concrete, is
+//written by HandleHTTPResponse, encoded by the codec or streamed,
+//and that its Header and Cookies methods, if any, are called.
+func (fd *FuncDefinition) checkResponse() bool {
+	t := fd.ResponseType
+	if !fd.Response || types.IsInterface(t) {
+		return true
+	}
+	for _, method := range []string{"Header", "Cookies"} {
+		if !hasMethod(t, method) && hasMethod(types.NewPointer(t), method) {
+			name := types.TypeString(t, (*types.Package).Name)
+			log.Printf("%s: %s has %s on its pointer, return a *%s for it to be called", fd.Name, name, method, name)
+			return false
+		}
+	}
+	if elem := streamElem(t); elem != nil {
+		if err := checkCodec("json", elem); err != nil {
+			log.Printf("%s: unsupported stream: %s", fd.Name, err)
 			return false
 		}
+		return true
+	}
+	if handledResponse(t) || isReader(t) {
+		return true
+	}
+	if err := checkCodec(fd.Codec, t); err != nil {
+		log.Printf("%s: unsupported response: %s", fd.Name, err)
+		return false
+	}
+	return true
+}
+
+//checkPathBindings checks that the path values read by
+//generated instantiators are wildcards of the route pattern.
+func (fd *FuncDefinition) checkPathBindings(pattern string, wildcards []string) bool {
+	for _, param := range fd.Instantiations {
+		for _, b := range param.Bindings {
+			if b.In == "path" && !contains(wildcards, b.Name) {
+				log.Printf("%s: field %s of %s reads path value %q, route %q has no such wildcard", fd.Name, b.Field, param.Name, b.Name, pattern)
+				return false
+			}
+		}
 	}
 	return true
 }
@@ -0,0 +1,9 @@
+// Package varhttp is the runtime of the handlers varhandler generates:
+// error and response handling, codecs, the setters of generated
+// instantiators and the requests of generated clients.
+//
+// Handlers generated use it, and are versioned with it: a handler calls
+// the helpers of the version of this module it is built with.
+// With -helpers=copy, varhandler writes these helpers into the package
+// instead, in a varhandler_helpers.go file.
+package varhttp // import "github.com/azr/generators/varhandler/varhttp"
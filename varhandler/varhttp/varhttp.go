@@ -0,0 +1,1471 @@
+package varhttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/gob"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Problem is the body of error responses, as described by RFC 9457:
+//application/problem+json.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	//InvalidParams are the fields a *ValidationError tells are invalid
+	InvalidParams []InvalidParam `json:"invalid-params,omitempty"`
+}
+
+//InvalidParam is a field of a param its Validate method rejects.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+//ServeHTTP answers r with p.
+func (p Problem) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := json.Marshal(p)
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	w.Write(b)
+}
+
+//errorStatuses are the statuses of errors, registered with RegisterErrorStatus.
+var errorStatuses []struct {
+	target error
+	status int
+}
+
+//RegisterErrorStatus makes HandleHTTPErrorWithDefaultStatus answer errors
+//matching target, as told by errors.Is, with status:
+//  RegisterErrorStatus(sql.ErrNoRows, http.StatusNotFound)
+//Errors registered first win. It must be called before serving.
+func RegisterErrorStatus(target error, status int) {
+	errorStatuses = append(errorStatuses, struct {
+		target error
+		status int
+	}{target, status})
+}
+
+//HandleHTTPErrorWithDefaultStatus handles err if it can or answers a Problem with default status
+//
+// if err, or an error it wraps as told by errors.As, is any of :
+// 	type HTTPError interface {
+// 	    HTTPError() (error string, code int)
+//  }
+//  http.Handler
+//  type SelfHTTPError interface {
+//  	HTTPError(w http.ResponseWriter)
+//  }
+//
+// according funcs will be called.
+// A body larger than the limit of a //varhandler:maxbody directive,
+// an *http.MaxBytesError, is answered with a 413.
+// Otherwise the status is the one err tells, as an error with a method
+//  StatusCode() int
+// the one registered for err with RegisterErrorStatus, or status:
+// http.StatusBadRequest for instantiators, unless set with a directive.
+// The Problem answered details err, unless its status is 500 or more:
+// the text of internal errors is not to be shown to clients.
+// This func is called by the handlers varhandler generates when your wrapped func returns
+// an error with default status
+func HandleHTTPErrorWithDefaultStatus(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if rw, ok := w.(*ResponseWriter); ok {
+		rw.observation.failed(err)
+	}
+	var (
+		httpError     interface{ HTTPError() (error string, code int) }
+		handler       http.Handler
+		selfHTTPError interface{ HTTPError(w http.ResponseWriter) }
+		validation    *ValidationError
+		tooLarge      *http.MaxBytesError
+	)
+	switch {
+	case errors.As(err, &validation):
+		validation.ServeHTTP(w, r)
+		return
+	case errors.As(err, &tooLarge):
+		WriteProblem(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body larger than %d bytes", tooLarge.Limit))
+		return
+	case errors.As(err, &httpError):
+		detail, code := httpError.HTTPError()
+		WriteProblem(w, r, code, detail)
+		return
+	case errors.As(err, &handler):
+		handler.ServeHTTP(w, r)
+		return
+	case errors.As(err, &selfHTTPError):
+		selfHTTPError.HTTPError(w)
+		return
+	}
+	status = errorStatus(err, status)
+	detail := ""
+	if err != nil && status < http.StatusInternalServerError {
+		detail = err.Error()
+	}
+	WriteProblem(w, r, status, detail)
+}
+
+//errorStatus returns the status err tells, as HandleHTTPErrorWithDefaultStatus
+//finds it, or status.
+func errorStatus(err error, status int) int {
+	var (
+		tooLarge    *http.MaxBytesError
+		httpError   interface{ HTTPError() (string, int) }
+		statusCoder interface{ StatusCode() int }
+	)
+	switch {
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.As(err, &httpError):
+		_, code := httpError.HTTPError()
+		return code
+	case errors.As(err, &statusCoder):
+		return statusCoder.StatusCode()
+	}
+	for _, e := range errorStatuses {
+		if errors.Is(err, e.target) {
+			return e.status
+		}
+	}
+	return status
+}
+
+//StatusClientClosedRequest is the status of a request its client
+//cancelled, as told to the HandlerObserver: the client doesn't read it.
+const StatusClientClosedRequest = 499
+
+//statusText returns the text of status, like http.StatusText,
+//StatusClientClosedRequest included.
+func statusText(status int) string {
+	if status == StatusClientClosedRequest {
+		return "Client Closed Request"
+	}
+	return http.StatusText(status)
+}
+
+//HandleContextError handles err, the error of the context of r once it
+//is done, for the request not to look like a success: it is answered
+//with a StatusClientClosedRequest, or a http.StatusServiceUnavailable
+//once its deadline is exceeded.
+func HandleContextError(w http.ResponseWriter, r *http.Request, err error) {
+	status := StatusClientClosedRequest
+	if errors.Is(err, context.DeadlineExceeded) {
+		status = http.StatusServiceUnavailable
+	}
+	HandleHTTPErrorWithDefaultStatus(w, r, status, err)
+}
+
+//WriteProblem answers r with a Problem of status and detail.
+func WriteProblem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	Problem{
+		Type:     "about:blank",
+		Title:    statusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	}.ServeHTTP(w, r)
+}
+
+//ResponseWriter defers the status of a response until its body starts,
+//so that headers can be set until then: the status written last before
+//the body, or before Commit, is the one answered.
+type ResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	committed   bool
+	observation *Observation // of the handler, if observed
+}
+
+//NewResponseWriter returns w wrapped into a *ResponseWriter,
+//or w if it is one already.
+func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	if rw, ok := w.(*ResponseWriter); ok {
+		return rw
+	}
+	return &ResponseWriter{ResponseWriter: w}
+}
+
+//WriteHeader sets the status written once the body starts.
+func (w *ResponseWriter) WriteHeader(status int) {
+	if !w.committed {
+		w.status = status
+	}
+}
+
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	w.Commit()
+	return w.ResponseWriter.Write(b)
+}
+
+//Flush commits the response and sends what was written to the client.
+func (w *ResponseWriter) Flush() {
+	w.Commit()
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+//Commit writes the status and headers of the response, if not done already.
+func (w *ResponseWriter) Commit() {
+	if w.committed {
+		return
+	}
+	w.committed = true
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+//Hijack takes over the connection of the wrapped http.Hijacker, for
+//websockets: the response is committed, nothing else is written to w.
+func (w *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %T can't be hijacked", http.ErrNotSupported, w.ResponseWriter)
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		w.committed = true
+	}
+	return conn, rw, err
+}
+
+//Committed tells whether the status and headers were written.
+func (w *ResponseWriter) Committed() bool { return w.committed }
+
+//Status returns the status of the response: http.StatusOK
+//unless another one was written.
+func (w *ResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+//Unwrap returns the wrapped http.ResponseWriter, for http.ResponseController.
+func (w *ResponseWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+//Observer is told about the stages of the handlers varhandler generates,
+//to measure or trace them, once set as HandlerObserver. handler is the
+//name of the wrapped func, param the type of an instantiated param.
+//Each stage is timed: instantiating a param, calling the func and
+//writing the response, of status.
+//OnError is told about every error answered, of any stage.
+type Observer interface {
+	OnInstantiate(r *http.Request, handler, param string, d time.Duration, err error)
+	OnCall(r *http.Request, handler string, d time.Duration, err error)
+	OnResponse(r *http.Request, handler string, status int, d time.Duration)
+	OnError(r *http.Request, handler string, err error)
+}
+
+//HandlerObserver observes the handlers varhandler generates, if set.
+//It must be set before serving.
+var HandlerObserver Observer
+
+//Observation tells HandlerObserver about the stages of a handler.
+//Its methods do nothing on a nil *Observation.
+type Observation struct {
+	Observer Observer
+	Request  *http.Request
+	Handler  string
+	start    time.Time // of the current stage
+}
+
+//Observe returns the Observation of the handler writing to w, a
+//*ResponseWriter, nil when there is no HandlerObserver. Errors handled
+//and the response of w are told to it, see Recover.
+func Observe(w http.ResponseWriter, r *http.Request, handler string) *Observation {
+	if HandlerObserver == nil {
+		return nil
+	}
+	o := &Observation{Observer: HandlerObserver, Request: r, Handler: handler, start: time.Now()}
+	NewResponseWriter(w).observation = o
+	return o
+}
+
+//Start starts a stage.
+func (o *Observation) Start() {
+	if o != nil {
+		o.start = time.Now()
+	}
+}
+
+//Instantiated ends the stage instantiating a param of type param.
+func (o *Observation) Instantiated(param string, err error) {
+	if o != nil {
+		o.Observer.OnInstantiate(o.Request, o.Handler, param, time.Since(o.start), err)
+		o.start = time.Now()
+	}
+}
+
+//Called ends the stage calling the func.
+func (o *Observation) Called(err error) {
+	if o != nil {
+		o.Observer.OnCall(o.Request, o.Handler, time.Since(o.start), err)
+		o.start = time.Now()
+	}
+}
+
+func (o *Observation) failed(err error) {
+	if o != nil {
+		o.Observer.OnError(o.Request, o.Handler, err)
+	}
+}
+
+func (o *Observation) responded(w *ResponseWriter) {
+	if o != nil {
+		o.Observer.OnResponse(o.Request, o.Handler, w.Status(), time.Since(o.start))
+	}
+}
+
+//PanicError is handled, with a http.StatusInternalServerError,
+//when a handler panics.
+type PanicError struct {
+	Value interface{} // recovered
+	Stack []byte      // of the goroutine that panicked
+}
+
+func (e *PanicError) Error() string { return fmt.Sprintf("panic: %v", e.Value) }
+
+//LogPanic is called with the PanicError of handlers that panic,
+//before it is handled. It logs it with its stack by default.
+var LogPanic = func(r *http.Request, err *PanicError) {
+	log.Printf("panic serving %s %s: %v\n%s", r.Method, r.URL.Path, err.Value, err.Stack)
+}
+
+//Recover is deferred by the handlers varhandler generates: it commits
+//the response of w, a *ResponseWriter, once the handler returns, and
+//tells its Observation. A panic
+//is recovered, passed to LogPanic and handled as a *PanicError, unless
+//the response was committed already: the connection is then aborted.
+//http.ErrAbortHandler is left to panic.
+func Recover(w http.ResponseWriter, r *http.Request) {
+	rw := NewResponseWriter(w)
+	defer rw.observation.responded(rw)
+	defer rw.Commit()
+	v := recover()
+	if v == nil {
+		return
+	}
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+	err := &PanicError{Value: v, Stack: debug.Stack()}
+	LogPanic(r, err)
+	if rw.Committed() {
+		panic(http.ErrAbortHandler)
+	}
+	HandleHTTPErrorWithDefaultStatus(rw, r, http.StatusInternalServerError, err)
+}
+
+//CopyHeader sets the values of header on the response of w,
+//replacing the ones it had. A *ResponseWriter writes them
+//along with the status, once the body starts.
+func CopyHeader(w http.ResponseWriter, header http.Header) {
+	for key, values := range header {
+		w.Header()[http.CanonicalHeaderKey(key)] = values
+	}
+}
+
+//ResponseHeader is a response setting headers of its own,
+//like Location after a create or Cache-Control.
+type ResponseHeader interface {
+	Header() http.Header
+}
+
+//ResponseCookies is a response setting cookies.
+type ResponseCookies interface {
+	Cookies() []*http.Cookie
+}
+
+//CopyResponseHeader copies the header of a ResponseHeader resp
+//and sets the cookies of a ResponseCookies resp on w,
+//before EncodeResponse writes the status.
+func CopyResponseHeader(w http.ResponseWriter, resp interface{}) {
+	if h, ok := resp.(ResponseHeader); ok {
+		CopyHeader(w, h.Header())
+	}
+	if c, ok := resp.(ResponseCookies); ok {
+		for _, cookie := range c.Cookies() {
+			http.SetCookie(w, cookie)
+		}
+	}
+}
+
+//HandleHTTPResponse writes resp in the format the request accepts,
+//see EncodeResponse. An http.Handler is called to write itself.
+func HandleHTTPResponse(w http.ResponseWriter, r *http.Request, resp interface{}) {
+	EncodeResponse(w, r, "", 0, resp)
+}
+
+//Codec encodes and decodes values to and from a media type.
+//A Codec returns an error wrapping ErrUnsupported
+//for values it can't encode or decode by design.
+type Codec struct {
+	Marshal   func(v interface{}) ([]byte, error)
+	Unmarshal func(data []byte, v interface{}) error
+}
+
+//ErrUnsupported is wrapped by the errors of codecs
+//for the types of values they don't handle.
+var ErrUnsupported = errors.New("unsupported type")
+
+//Codecs are the codecs of responses, by media type, used by clients to
+//decode them too. Add to it, before serving, to support more formats.
+//Request bodies are decoded by Decoders.
+var Codecs = map[string]Codec{
+	"application/json": {
+		Marshal: func(v interface{}) ([]byte, error) {
+			b, err := json.Marshal(v)
+			var unsupported *json.UnsupportedTypeError
+			if errors.As(err, &unsupported) {
+				err = fmt.Errorf("%w: %s", ErrUnsupported, err)
+			}
+			return b, err
+		},
+		Unmarshal: json.Unmarshal,
+	},
+	"application/xml": {
+		Marshal: func(v interface{}) ([]byte, error) {
+			b, err := xml.Marshal(v)
+			var unsupported *xml.UnsupportedTypeError
+			if errors.As(err, &unsupported) {
+				err = fmt.Errorf("%w: %s", ErrUnsupported, err)
+			}
+			return b, err
+		},
+		Unmarshal: xml.Unmarshal,
+	},
+	"application/x-gob": {
+		Marshal: func(v interface{}) ([]byte, error) {
+			var buf bytes.Buffer
+			err := gob.NewEncoder(&buf).Encode(v)
+			return buf.Bytes(), err
+		},
+		Unmarshal: func(data []byte, v interface{}) error {
+			return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+		},
+	},
+	// fmt.Stringer, encoding.TextMarshaler and strings
+	"text/plain": {
+		Marshal: func(v interface{}) ([]byte, error) {
+			switch t := v.(type) {
+			case fmt.Stringer:
+				return []byte(t.String()), nil
+			case encoding.TextMarshaler:
+				return t.MarshalText()
+			}
+			if rv := reflect.ValueOf(v); rv.Kind() == reflect.String {
+				return []byte(rv.String()), nil
+			}
+			return nil, fmt.Errorf("%w: %T is not text", ErrUnsupported, v)
+		},
+		Unmarshal: func(data []byte, v interface{}) error {
+			if t, ok := v.(encoding.TextUnmarshaler); ok {
+				return t.UnmarshalText(data)
+			}
+			if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.String {
+				rv.Elem().SetString(string(data))
+				return nil
+			}
+			return fmt.Errorf("%w: %T is not text", ErrUnsupported, v)
+		},
+	},
+	// []byte and types with a Bytes() []byte method
+	"application/octet-stream": {
+		Marshal: func(v interface{}) ([]byte, error) {
+			switch t := v.(type) {
+			case []byte:
+				return t, nil
+			case interface{ Bytes() []byte }:
+				return t.Bytes(), nil
+			}
+			return nil, fmt.Errorf("%w: %T is not bytes", ErrUnsupported, v)
+		},
+		Unmarshal: func(data []byte, v interface{}) error {
+			if b, ok := v.(*[]byte); ok {
+				*b = data
+				return nil
+			}
+			return fmt.Errorf("%w: %T is not bytes", ErrUnsupported, v)
+		},
+	},
+}
+
+//ErrNotAcceptable is handled, with a http.StatusNotAcceptable,
+//when no codec accepted by the request can encode the response.
+var ErrNotAcceptable = errors.New("no acceptable media type")
+
+//EncodeResponse writes status, unless it is 0, and resp unless it is nil.
+//The header and cookies of resp are set first, see CopyResponseHeader.
+//An http.Handler writes itself, a stream is streamed, see Stream.
+//Otherwise resp is encoded with a codec
+//of Codecs, picked from the Accept header of the request, and the
+//Content-Type is set. When the request accepts more than one media type
+//as much, the first that encodes resp is used, in this order:
+//application/octet-stream for bytes, text/plain for a fmt.Stringer,
+//mediaType, then the other codecs.
+//
+//ErrNotAcceptable is handled when none of the accepted codecs encodes resp,
+//and a failing codec is handled as a http.StatusInternalServerError,
+//before anything is written.
+func EncodeResponse(w http.ResponseWriter, r *http.Request, mediaType string, status int, resp interface{}) {
+	if v := reflect.ValueOf(resp); resp == nil || v.Kind() == reflect.Ptr && v.IsNil() {
+		if status != 0 {
+			w.WriteHeader(status)
+		}
+		return
+	}
+	CopyResponseHeader(w, resp)
+	if h, ok := resp.(http.Handler); ok {
+		if status != 0 {
+			w.WriteHeader(status)
+		}
+		h.ServeHTTP(w, r) // resp knows how to handle itself
+		return
+	}
+
+	var preferred []string
+	switch resp.(type) {
+	case []byte, interface{ Bytes() []byte }:
+		preferred = append(preferred, "application/octet-stream")
+	case fmt.Stringer:
+		preferred = append(preferred, "text/plain")
+	default:
+		if Stream(w, r, status, resp) {
+			return
+		}
+	}
+	if mediaType != "" {
+		preferred = append(preferred, mediaType)
+	}
+	for _, mediaType := range NegotiateContentTypes(r.Header.Get("Accept"), preferred...) {
+		b, err := Codecs[mediaType].Marshal(resp)
+		if errors.Is(err, ErrUnsupported) {
+			continue
+		}
+		if err != nil {
+			HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		if strings.HasPrefix(mediaType, "text/") {
+			mediaType += "; charset=utf-8"
+		}
+		w.Header().Set("Content-Type", mediaType)
+		if status != 0 {
+			w.WriteHeader(status)
+		}
+		w.Write(b)
+		return
+	}
+	HandleHTTPErrorWithDefaultStatus(w, r, http.StatusNotAcceptable, ErrNotAcceptable)
+}
+
+//Media types of the streams of values, see Stream.
+const (
+	NDJSON      = "application/x-ndjson"
+	EventStream = "text/event-stream"
+)
+
+//Stream streams resp to w, with status unless it is 0, and tells whether
+//resp is a stream:
+//  - an io.Reader is written as it is read, as application/octet-stream
+//    unless a Content-Type is set, and closed if it is an io.Closer,
+//  - the values received from a <-chan T, until it is closed, or yielded
+//    by an iter.Seq[T] are encoded by the json codec of Codecs, one per
+//    line as NDJSON, or as the data of the events of an EventStream when
+//    the request accepts it better. A nil channel or sequence is empty.
+//The status and headers of a reader are sent with its first bytes, the
+//ones of a stream of values before its first value, and the response
+//is flushed after each read or value. ErrNotAcceptable is handled when
+//the request accepts neither NDJSON nor EventStream. Streaming stops
+//once the request is done. An error is handled if nothing was sent yet,
+//otherwise the response is aborted for the client not to take it as
+//complete.
+func Stream(w http.ResponseWriter, r *http.Request, status int, resp interface{}) bool {
+	ctx := r.Context()
+	s := &streamWriter{w: w, status: status}
+	var err error
+	if reader, ok := resp.(io.Reader); ok {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		err = s.copy(ctx, reader)
+	} else if v := reflect.ValueOf(resp); isValueStream(v.Type()) {
+		mediaTypes := negotiate(r.Header.Get("Accept"), []string{NDJSON, EventStream})
+		if len(mediaTypes) == 0 {
+			HandleHTTPErrorWithDefaultStatus(w, r, http.StatusNotAcceptable, ErrNotAcceptable)
+			return true
+		}
+		s.events = mediaTypes[0] == EventStream
+		if s.events {
+			w.Header().Set("Content-Type", EventStream)
+			if w.Header().Get("Cache-Control") == "" {
+				w.Header().Set("Cache-Control", "no-cache")
+			}
+		} else {
+			w.Header().Set("Content-Type", NDJSON)
+		}
+		err = s.values(ctx, v)
+	} else {
+		return false
+	}
+	switch {
+	case err != nil && !s.started:
+		HandleHTTPErrorWithDefaultStatus(w, r, http.StatusInternalServerError, err)
+	case err != nil:
+		if rw, ok := w.(*ResponseWriter); ok {
+			rw.observation.failed(err)
+		}
+		panic(http.ErrAbortHandler)
+	case !s.started && status != 0:
+		w.WriteHeader(status)
+	}
+	return true
+}
+
+//isValueStream tells whether t is a <-chan T or an iter.Seq[T]:
+//a func(yield func(T) bool).
+func isValueStream(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Chan:
+		return t.ChanDir()&reflect.RecvDir != 0
+	case reflect.Func:
+		if t.NumIn() != 1 || t.NumOut() != 0 {
+			return false
+		}
+		yield := t.In(0)
+		return yield.Kind() == reflect.Func && yield.NumIn() == 1 &&
+			yield.NumOut() == 1 && yield.Out(0).Kind() == reflect.Bool
+	}
+	return false
+}
+
+//streamWriter writes a stream to w, flushing after each write.
+type streamWriter struct {
+	w       http.ResponseWriter
+	status  int
+	events  bool // values are written as events, not lines
+	started bool
+}
+
+func (s *streamWriter) Write(b []byte) (int, error) {
+	if !s.started {
+		s.start()
+	}
+	n, err := s.w.Write(b)
+	if err == nil {
+		http.NewResponseController(s.w).Flush()
+	}
+	return n, err
+}
+
+//start writes the status and headers, flushed for the client
+//to see the stream begin.
+func (s *streamWriter) start() {
+	s.started = true
+	if s.status != 0 {
+		s.w.WriteHeader(s.status)
+	}
+	http.NewResponseController(s.w).Flush()
+}
+
+//copy writes what is read from reader until its end, closing it if it
+//is an io.Closer, when ctx is done too to stop a blocked read.
+//Writing stops quietly when the client is gone.
+func (s *streamWriter) copy(ctx context.Context, reader io.Reader) error {
+	if c, ok := reader.(io.Closer); ok {
+		stop := context.AfterFunc(ctx, func() { c.Close() })
+		defer func() {
+			if stop() {
+				c.Close()
+			}
+		}()
+	}
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			if _, err := s.Write(buf[:n]); err != nil {
+				return nil
+			}
+		}
+		if err == io.EOF || ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+//values writes the values of the stream v until it ends,
+//ctx is done or the client is gone, once the stream started.
+func (s *streamWriter) values(ctx context.Context, v reflect.Value) error {
+	s.start()
+	if v.IsNil() {
+		return nil
+	}
+	var err error
+	write := func(value reflect.Value) bool {
+		var b []byte
+		if b, err = Codecs["application/json"].Marshal(value.Interface()); err != nil {
+			return false
+		}
+		if s.events {
+			b = append(append([]byte("data: "), b...), "\n\n"...)
+		} else {
+			b = append(b, '\n')
+		}
+		_, werr := s.Write(b)
+		return werr == nil && ctx.Err() == nil
+	}
+	if v.Kind() == reflect.Chan {
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+			{Dir: reflect.SelectRecv, Chan: v},
+		}
+		for {
+			chosen, value, ok := reflect.Select(cases)
+			if chosen == 0 || !ok || !write(value) {
+				return err
+			}
+		}
+	}
+	yield := v.Type().In(0)
+	v.Call([]reflect.Value{reflect.MakeFunc(yield, func(args []reflect.Value) []reflect.Value {
+		return []reflect.Value{reflect.ValueOf(write(args[0])).Convert(yield.Out(0))}
+	})})
+	return err
+}
+
+//NegotiateContentTypes returns the media types of Codecs the Accept header
+//accepts, most accepted first as told by q-values and the specificity of
+//the media ranges. Ties are in the order of preferred, then sorted.
+//Everything is accepted when accept is empty.
+func NegotiateContentTypes(accept string, preferred ...string) []string {
+	var candidates, others []string
+	for _, mediaType := range preferred {
+		if _, ok := Codecs[mediaType]; ok {
+			candidates = append(candidates, mediaType)
+		}
+	}
+	for mediaType := range Codecs {
+		others = append(others, mediaType)
+	}
+	sort.Strings(others)
+	return negotiate(accept, append(candidates, others...))
+}
+
+//negotiate returns the candidates accept accepts, most accepted first,
+//ties in the order of candidates.
+func negotiate(accept string, candidates []string) []string {
+	seen := make(map[string]bool)
+	type accepted struct {
+		mediaType string
+		q         float64
+	}
+	var list []accepted
+	for _, mediaType := range candidates {
+		if seen[mediaType] {
+			continue
+		}
+		seen[mediaType] = true
+		q := acceptQuality(accept, mediaType)
+		if q > 0 {
+			list = append(list, accepted{mediaType, q})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].q > list[j].q })
+	mediaTypes := make([]string, len(list))
+	for i, a := range list {
+		mediaTypes[i] = a.mediaType
+	}
+	return mediaTypes
+}
+
+//acceptQuality returns the q-value the Accept header accept gives
+//mediaType: the one of its most specific matching media range.
+func acceptQuality(accept, mediaType string) float64 {
+	if strings.TrimSpace(accept) == "" {
+		return 1
+	}
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	q, specificity := 0.0, -1
+	for _, r := range strings.Split(accept, ",") {
+		rangeType, params, _ := strings.Cut(r, ";")
+		rangeType = strings.ToLower(strings.TrimSpace(rangeType))
+		rtyp, rsubtype, _ := strings.Cut(rangeType, "/")
+		s := 0
+		switch {
+		case rtyp == typ && rsubtype == subtype:
+			s = 2
+		case rtyp == typ && rsubtype == "*":
+			s = 1
+		case rtyp == "*" && rsubtype == "*":
+			s = 0
+		default:
+			continue
+		}
+		if s <= specificity {
+			continue
+		}
+		rq := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				if f, err := strconv.ParseFloat(value, 64); err == nil {
+					rq = f
+				}
+			}
+		}
+		q, specificity = rq, s
+	}
+	return q
+}
+
+//UnsupportedMediaTypeError is returned when a body has a
+//Content-Type it is not decoded from: another one than the
+//format of its body tag, or one no codec of a client decodes.
+//It is answered with a http.StatusUnsupportedMediaType.
+type UnsupportedMediaTypeError struct {
+	ContentType string
+}
+
+func (e *UnsupportedMediaTypeError) Error() string {
+	return fmt.Sprintf("unsupported media type %q", e.ContentType)
+}
+
+//HTTPError makes UnsupportedMediaTypeError an HTTPError
+func (e *UnsupportedMediaTypeError) HTTPError() (string, int) {
+	return e.Error(), http.StatusUnsupportedMediaType
+}
+
+//FieldError is returned by a generated instantiator when a value
+//of the request can't be set into a field of the param.
+//It is answered with a http.StatusBadRequest.
+//
+//The Validate method of a param returns it, without In and Name,
+//to tell which field is invalid, see ValidationError.
+type FieldError struct {
+	Field string // name of the field
+	In    string // path, query, header, cookie, form, file or body
+	Name  string // name of the value in the request, format of a body
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	if e.In == "" {
+		return fmt.Sprintf("invalid %s: %s", e.Field, e.reason())
+	}
+	if e.In == "body" {
+		return fmt.Sprintf("invalid %s body: %s", e.Name, e.reason())
+	}
+	if e.In == "file" {
+		return fmt.Sprintf("invalid file %q: %s", e.Name, e.reason())
+	}
+	return fmt.Sprintf("invalid %s value %q: %s", e.In, e.Name, e.reason())
+}
+
+//reason tells why the field is invalid: Err, if set.
+func (e *FieldError) reason() string {
+	if e.Err == nil {
+		return "is invalid"
+	}
+	return e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error { return e.Err }
+
+//HTTPError makes FieldError an HTTPError, with the status Err tells,
+//as HandleHTTPErrorWithDefaultStatus finds it, or a
+//http.StatusBadRequest.
+func (e *FieldError) HTTPError() (string, int) {
+	return e.Error(), errorStatus(e.Err, http.StatusBadRequest)
+}
+
+//ValidationError is returned by a handler when the Validate method
+//of a param fails. It is answered with a http.StatusUnprocessableEntity
+//Problem listing the *FieldError Err is made of, if any:
+//  func (u User) Validate() error {
+//  	if u.Name == "" {
+//  		return &FieldError{Field: "Name", Err: errors.New("is empty")}
+//  	}
+//  	return nil
+//  }
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	if e.Err == nil {
+		return "validation failed"
+	}
+	return e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+//ServeHTTP answers r with the Problem of e.
+func (e *ValidationError) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(http.StatusUnprocessableEntity),
+		Status:   http.StatusUnprocessableEntity,
+		Detail:   e.Error(),
+		Instance: r.URL.Path,
+	}
+	var walk func(err error)
+	walk = func(err error) {
+		switch err := err.(type) {
+		case *FieldError:
+			if err != nil {
+				p.InvalidParams = append(p.InvalidParams, InvalidParam{Name: err.Field, Reason: err.reason()})
+			}
+		case interface{ Unwrap() []error }:
+			for _, err := range err.Unwrap() {
+				walk(err)
+			}
+		case interface{ Unwrap() error }:
+			walk(err.Unwrap())
+		}
+	}
+	walk(e.Err)
+	p.ServeHTTP(w, r)
+}
+
+//CookieValue returns the value of the named cookie, or "" if it's not set.
+func CookieValue(r *http.Request, name string) string {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+//Decoders are the decoders of request bodies, by media type. They are
+//apart from Codecs so that adding a response format never widens what
+//the server parses. Add to it, before serving, to support more formats.
+var Decoders = map[string]func(data []byte, v interface{}) error{
+	"application/json": json.Unmarshal,
+	"application/xml":  xml.Unmarshal,
+	"application/x-gob": func(data []byte, v interface{}) error {
+		return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+	},
+}
+
+//DecodeBody decodes the body of r into v with the decoder of mediaType,
+//the one of the body tag: the Content-Type of the request, if any, must
+//be mediaType. An *UnsupportedMediaTypeError is returned otherwise.
+func DecodeBody(r *http.Request, mediaType string, v interface{}) error {
+	if err := checkContentType(r, mediaType); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return Decoders[mediaType](data, v)
+}
+
+//ErrTrailingData is returned by DecodeStrictBody
+//when a json body has data after its value.
+var ErrTrailingData = errors.New("data after the json value")
+
+//DecodeStrictBody decodes the json body of r into v like DecodeBody,
+//strictly: an unknown field is an error, and so is ErrTrailingData.
+//mediaType must be application/json: strictness is not to be skipped,
+//any other is an *UnsupportedMediaTypeError.
+func DecodeStrictBody(r *http.Request, mediaType string, v interface{}) error {
+	if err := checkContentType(r, mediaType); err != nil {
+		return err
+	}
+	if mediaType != "application/json" {
+		return &UnsupportedMediaTypeError{ContentType: mediaType}
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	var tooLarge *http.MaxBytesError
+	if _, err := dec.Token(); errors.As(err, &tooLarge) {
+		return err
+	} else if err != io.EOF {
+		return ErrTrailingData
+	}
+	return nil
+}
+
+//checkContentType returns an *UnsupportedMediaTypeError unless the body
+//of r is of mediaType, as told by its Content-Type if it has one, and
+//Decoders has a decoder for it.
+func checkContentType(r *http.Request, mediaType string) error {
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		if got, _, err := mime.ParseMediaType(contentType); err != nil || got != mediaType {
+			return &UnsupportedMediaTypeError{ContentType: contentType}
+		}
+	}
+	if _, ok := Decoders[mediaType]; !ok {
+		return &UnsupportedMediaTypeError{ContentType: mediaType}
+	}
+	return nil
+}
+
+//MultipartMaxMemory is the memory ParseMultipartForm keeps the
+//multipart form of a request in: the files past it are stored in
+//temporary files, removed by RemoveMultipartForm. Set it before serving.
+var MultipartMaxMemory int64 = 32 << 20
+
+//ParseMultipartForm parses the multipart form of r once, keeping up to
+//MultipartMaxMemory bytes of it in memory. A request that is not
+//multipart is parsed as a form without files.
+func ParseMultipartForm(r *http.Request) error {
+	if r.MultipartForm != nil {
+		return nil
+	}
+	if err := r.ParseMultipartForm(MultipartMaxMemory); err != http.ErrNotMultipart {
+		return err
+	}
+	return nil
+}
+
+//RemoveMultipartForm removes the temporary files of the multipart
+//form of r, if any. Handlers reading files defer it.
+func RemoveMultipartForm(r *http.Request) {
+	if r.MultipartForm != nil {
+		r.MultipartForm.RemoveAll()
+	}
+}
+
+//SetFormFile, SetFormFiles and OpenFormFile set dst from the files of
+//the multipart form of r named name, see ParseMultipartForm: the first
+//file, all of them, or the first opened, to be closed with CloseFormFile.
+//http.ErrMissingFile is returned when there is none.
+func SetFormFile(r *http.Request, name string, dst **multipart.FileHeader) error {
+	var files []*multipart.FileHeader
+	if err := SetFormFiles(r, name, &files); err != nil {
+		return err
+	}
+	*dst = files[0]
+	return nil
+}
+
+func SetFormFiles(r *http.Request, name string, dst *[]*multipart.FileHeader) error {
+	if err := ParseMultipartForm(r); err != nil {
+		return err
+	}
+	if r.MultipartForm == nil || len(r.MultipartForm.File[name]) == 0 {
+		return http.ErrMissingFile
+	}
+	*dst = r.MultipartForm.File[name]
+	return nil
+}
+
+func OpenFormFile[T io.Reader](r *http.Request, name string, dst *T) error {
+	var fh *multipart.FileHeader
+	if err := SetFormFile(r, name, &fh); err != nil {
+		return err
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	v, ok := f.(T)
+	if !ok {
+		f.Close()
+		return fmt.Errorf("cannot set a %T into a %T", f, dst)
+	}
+	*dst = v
+	return nil
+}
+
+//CloseFormFile closes a file opened by OpenFormFile, if any.
+func CloseFormFile(f io.Reader) {
+	if c, ok := f.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+//SetString, SetInt, SetUint, SetFloat, SetBool and SetDuration
+//parse s into dst; generated instantiators use them to set
+//the fields of a param from the request.
+func SetString[T ~string](dst *T, s string) error {
+	*dst = T(s)
+	return nil
+}
+
+func SetInt[T ~int | ~int8 | ~int16 | ~int32 | ~int64](dst *T, s string) error {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err == nil && int64(T(n)) != n {
+		err = &strconv.NumError{Func: "ParseInt", Num: s, Err: strconv.ErrRange}
+	}
+	*dst = T(n)
+	return err
+}
+
+func SetUint[T ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr](dst *T, s string) error {
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err == nil && uint64(T(n)) != n {
+		err = &strconv.NumError{Func: "ParseUint", Num: s, Err: strconv.ErrRange}
+	}
+	*dst = T(n)
+	return err
+}
+
+func SetFloat[T ~float32 | ~float64](dst *T, s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	*dst = T(f)
+	return err
+}
+
+func SetBool[T ~bool](dst *T, s string) error {
+	b, err := strconv.ParseBool(s)
+	*dst = T(b)
+	return err
+}
+
+func SetDuration(dst *time.Duration, s string) error {
+	d, err := time.ParseDuration(s)
+	*dst = d
+	return err
+}
+
+//Route is a handler generated for a method along with
+//a pattern of its //varhandler:route directives.
+type Route struct {
+	Pattern string
+	Handler http.Handler
+}
+
+//HandleRoutes registers the handlers of routes on mux, like
+//the Routes method generated for a receiver returns them.
+func HandleRoutes(mux *http.ServeMux, routes []Route) {
+	for _, route := range routes {
+		mux.Handle(route.Pattern, route.Handler)
+	}
+}
+
+//ClientRequest is a request of a generated client,
+//its values are set the way generated instantiators read them.
+type ClientRequest struct {
+	method, pattern string
+	path            map[string]string
+	query, form     url.Values
+	header          http.Header
+	cookies         []*http.Cookie
+	files           []clientFile
+	body            interface{}
+	mediaType       string
+	encoders        []func(*http.Request) error
+	err             error
+}
+
+//NewClientRequest returns a request for the route method pattern,
+//pattern being the path of a http.ServeMux pattern like /users/{id}.
+func NewClientRequest(method, pattern string) *ClientRequest {
+	return &ClientRequest{
+		method:  method,
+		pattern: pattern,
+		path:    make(map[string]string),
+		query:   make(url.Values),
+		form:    make(url.Values),
+		header:  make(http.Header),
+	}
+}
+
+//Set formats v with FormatValue and sets it as the named value
+//of the request; in is path, query, header, cookie or form.
+//Empty values are left unset, as instantiators do not read them.
+func (r *ClientRequest) Set(in, name string, v interface{}) {
+	s, err := FormatValue(v)
+	if err != nil {
+		if r.err == nil {
+			r.err = &FieldError{In: in, Name: name, Err: err}
+		}
+		return
+	}
+	if s == "" {
+		return
+	}
+	switch in {
+	case "path":
+		r.path[name] = s
+	case "query":
+		r.query.Set(name, s)
+	case "header":
+		r.header.Set(name, s)
+	case "cookie":
+		r.cookies = append(r.cookies, &http.Cookie{Name: name, Value: s})
+	case "form":
+		r.form.Set(name, s)
+	}
+}
+
+//clientFile is a file of the multipart form of a ClientRequest.
+type clientFile struct {
+	name, filename string
+	open           func() (io.Reader, error)
+}
+
+//SetFile adds v to the files of the multipart form of the request, named
+//name: an io.Reader, a *multipart.FileHeader or a []*multipart.FileHeader.
+//Nil values are left unset.
+func (r *ClientRequest) SetFile(name string, v interface{}) {
+	switch v := v.(type) {
+	case *multipart.FileHeader:
+		if v != nil {
+			r.files = append(r.files, clientFile{name, v.Filename, func() (io.Reader, error) { return v.Open() }})
+		}
+	case []*multipart.FileHeader:
+		for _, fh := range v {
+			r.SetFile(name, fh)
+		}
+	case io.Reader:
+		if rv := reflect.ValueOf(v); rv.Kind() != reflect.Ptr || !rv.IsNil() {
+			r.files = append(r.files, clientFile{name, name, func() (io.Reader, error) { return v, nil }})
+		}
+	}
+}
+
+//multipart returns the multipart form of the form values and
+//files of the request, and its Content-Type.
+func (r *ClientRequest) multipart() ([]byte, string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for name, values := range r.form {
+		for _, value := range values {
+			if err := mw.WriteField(name, value); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	for _, file := range r.files {
+		part, err := mw.CreateFormFile(file.name, file.filename)
+		if err != nil {
+			return nil, "", err
+		}
+		f, err := file.open()
+		if err != nil {
+			return nil, "", err
+		}
+		_, err = io.Copy(part, f)
+		CloseFormFile(f)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), mw.FormDataContentType(), nil
+}
+
+//SetBody sets v as the body of the request,
+//encoded with the codec of mediaType.
+func (r *ClientRequest) SetBody(mediaType string, v interface{}) {
+	r.mediaType, r.body = mediaType, v
+}
+
+//Encode adds an encoder called once the request is built.
+func (r *ClientRequest) Encode(encoder func(*http.Request) error) {
+	r.encoders = append(r.encoders, encoder)
+}
+
+//Request returns the http request to send to baseURL.
+func (r *ClientRequest) Request(ctx context.Context, baseURL string) (*http.Request, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	var segments []string
+	for _, segment := range strings.Split(r.pattern, "/") {
+		if segment == "{$}" {
+			segment = ""
+		} else if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			name := segment[1 : len(segment)-1]
+			if strings.HasSuffix(name, "...") { // matches the remaining segments
+				values := strings.Split(r.path[strings.TrimSuffix(name, "...")], "/")
+				for i := range values {
+					values[i] = url.PathEscape(values[i])
+				}
+				segment = strings.Join(values, "/")
+			} else {
+				segment = url.PathEscape(r.path[name])
+			}
+		}
+		segments = append(segments, segment)
+	}
+	u := baseURL + strings.Join(segments, "/")
+	if len(r.query) > 0 {
+		u += "?" + r.query.Encode()
+	}
+
+	var body []byte
+	contentType := ""
+	switch {
+	case r.body != nil && (len(r.form) > 0 || len(r.files) > 0):
+		return nil, fmt.Errorf("request has both a %s body and form values", r.mediaType)
+	case r.body != nil:
+		c, ok := Codecs[r.mediaType]
+		if !ok {
+			return nil, &UnsupportedMediaTypeError{ContentType: r.mediaType}
+		}
+		var err error
+		if body, err = c.Marshal(r.body); err != nil {
+			return nil, err
+		}
+		contentType = r.mediaType
+	case len(r.files) > 0:
+		var err error
+		if body, contentType, err = r.multipart(); err != nil {
+			return nil, err
+		}
+	case len(r.form) > 0:
+		body = []byte(r.form.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body, req.GetBody, req.ContentLength = http.NoBody, nil, 0
+	}
+	for name, values := range r.header {
+		req.Header[name] = values
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for _, c := range r.cookies {
+		req.AddCookie(c)
+	}
+	for _, encode := range r.encoders {
+		if err := encode(req); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+//FormatValue formats v into a string the Set helpers parse back:
+//strings, ints, uints, floats, bools, time.Duration
+//or any encoding.TextMarshaler.
+func FormatValue(v interface{}) (string, error) {
+	switch t := v.(type) {
+	case encoding.TextMarshaler:
+		b, err := t.MarshalText()
+		return string(b), err
+	case time.Duration:
+		return t.String(), nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'g', -1, rv.Type().Bits()), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	}
+	return "", fmt.Errorf("cannot format a %T", v)
+}
+
+//StatusError is the error of a response of a generated client
+//with a status of 400 or more, its message being the detail of
+//its Problem, or its body. It is an HTTPError, so that a handler
+//returning it answers with the same status and message.
+type StatusError struct {
+	Code    int
+	Message string
+	Problem *Problem // nil if the body is not application/problem+json
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return statusText(e.Code)
+	}
+	return fmt.Sprintf("%s: %s", statusText(e.Code), e.Message)
+}
+
+//HTTPError makes StatusError an HTTPError
+func (e *StatusError) HTTPError() (string, int) { return e.Message, e.Code }
+
+//DecodeResponse closes the body of res after decoding it into v,
+//unless v is nil. A status of 400 or more is returned as a *StatusError.
+//v can be a *[]byte, a pointer to a slice the values of an NDJSON
+//stream are appended to, or anything the codec of the Content-Type
+//of the response decodes, json when it has none.
+//An empty body leaves v unset.
+func DecodeResponse(res *http.Response, v interface{}) error {
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode >= 400 {
+		e := &StatusError{Code: res.StatusCode, Message: strings.TrimSpace(string(body))}
+		mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+		if p := new(Problem); mediaType == "application/problem+json" && json.Unmarshal(body, p) == nil {
+			e.Problem, e.Message = p, p.Detail
+		}
+		return e
+	}
+	if v == nil || len(body) == 0 {
+		return nil
+	}
+	if b, ok := v.(*[]byte); ok {
+		*b = body
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "application/json"
+	}
+	if slice := reflect.ValueOf(v).Elem(); mediaType == NDJSON && slice.Kind() == reflect.Slice {
+		// the values of a stream, appended one line at a time
+		for _, line := range bytes.Split(body, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			value := reflect.New(slice.Type().Elem())
+			if err := Codecs["application/json"].Unmarshal(line, value.Interface()); err != nil {
+				return err
+			}
+			slice.Set(reflect.Append(slice, value.Elem()))
+		}
+		return nil
+	}
+	c, ok := Codecs[mediaType]
+	if !ok {
+		return &UnsupportedMediaTypeError{ContentType: mediaType}
+	}
+	return c.Unmarshal(body, v)
+}
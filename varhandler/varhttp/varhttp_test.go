@@ -0,0 +1,405 @@
+package varhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// problem returns the Problem rec was answered with.
+func problem(t *testing.T, rec *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("Content-Type = %q, want application/problem+json", ct)
+	}
+	var p Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decoding the problem: %s", err)
+	}
+	if p.Status != rec.Code {
+		t.Errorf("problem status = %d, answered with %d", p.Status, rec.Code)
+	}
+	return p
+}
+
+type statusCodeError int
+
+func (e statusCodeError) Error() string   { return fmt.Sprintf("status %d", int(e)) }
+func (e statusCodeError) StatusCode() int { return int(e) }
+
+type httpError struct{}
+
+func (httpError) Error() string            { return "teapot" }
+func (httpError) HTTPError() (string, int) { return "short and stout", http.StatusTeapot }
+
+func TestHandleHTTPErrorWithDefaultStatus(t *testing.T) {
+	errNotFound := errors.New("not found")
+	errConflict := errors.New("conflict")
+	defer func(saved []struct {
+		target error
+		status int
+	}) {
+		errorStatuses = saved
+	}(errorStatuses)
+	RegisterErrorStatus(errNotFound, http.StatusNotFound)
+	RegisterErrorStatus(errConflict, http.StatusConflict)
+	RegisterErrorStatus(errNotFound, http.StatusGone)
+
+	for _, test := range []struct {
+		name       string
+		status     int
+		err        error
+		wantStatus int
+		wantDetail string
+	}{
+		{"default", http.StatusBadRequest, errors.New("bad"), http.StatusBadRequest, "bad"},
+		{"internal errors are not detailed", http.StatusInternalServerError, errors.New("secret"), http.StatusInternalServerError, ""},
+		{"registered", http.StatusBadRequest, fmt.Errorf("get: %w", errNotFound), http.StatusNotFound, "get: not found"},
+		{"first registered wins", http.StatusBadRequest, errNotFound, http.StatusNotFound, "not found"},
+		{"status code over registered", http.StatusBadRequest, errors.Join(errConflict, statusCodeError(http.StatusTooManyRequests)), http.StatusTooManyRequests, "conflict\nstatus 429"},
+		{"HTTPError over status code", http.StatusBadRequest, errors.Join(statusCodeError(http.StatusTooManyRequests), httpError{}), http.StatusTeapot, "short and stout"},
+		{"too large over HTTPError", http.StatusBadRequest, errors.Join(httpError{}, &http.MaxBytesError{Limit: 10}), http.StatusRequestEntityTooLarge, "request body larger than 10 bytes"},
+		{"field error", http.StatusBadRequest, &FieldError{Field: "ID", In: "path", Name: "id", Err: errors.New("not a number")}, http.StatusBadRequest, `invalid path value "id": not a number`},
+		{"field error of a registered error", http.StatusBadRequest, &FieldError{Field: "ID", In: "path", Name: "id", Err: errNotFound}, http.StatusNotFound, `invalid path value "id": not found`},
+		{"field error of a status code", http.StatusBadRequest, &FieldError{Field: "ID", In: "path", Name: "id", Err: statusCodeError(http.StatusForbidden)}, http.StatusForbidden, `invalid path value "id": status 403`},
+		{"field error without error", http.StatusBadRequest, &FieldError{Field: "ID", In: "query", Name: "id"}, http.StatusBadRequest, `invalid query value "id": is invalid`},
+		{"unsupported media type", http.StatusBadRequest, &UnsupportedMediaTypeError{ContentType: "text/xml"}, http.StatusUnsupportedMediaType, `unsupported media type "text/xml"`},
+		{"validation error without error", http.StatusBadRequest, &ValidationError{}, http.StatusUnprocessableEntity, "validation failed"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/users/1", nil)
+			HandleHTTPErrorWithDefaultStatus(rec, r, test.status, test.err)
+			if rec.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, test.wantStatus)
+			}
+			p := problem(t, rec)
+			if p.Detail != test.wantDetail {
+				t.Errorf("detail = %q, want %q", p.Detail, test.wantDetail)
+			}
+			if p.Title != http.StatusText(test.wantStatus) || p.Instance != "/users/1" {
+				t.Errorf("problem = %+v, want the title of %d and the path", p, test.wantStatus)
+			}
+		})
+	}
+}
+
+func TestValidationErrorInvalidParams(t *testing.T) {
+	err := &ValidationError{Err: fmt.Errorf("user: %w", errors.Join(
+		&FieldError{Field: "Name", Err: errors.New("is empty")},
+		(*FieldError)(nil),
+		&FieldError{Field: "Age"},
+	))}
+	rec := httptest.NewRecorder()
+	HandleHTTPErrorWithDefaultStatus(rec, httptest.NewRequest("POST", "/users", nil), http.StatusBadRequest, err)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	want := []InvalidParam{{Name: "Name", Reason: "is empty"}, {Name: "Age", Reason: "is invalid"}}
+	if got := problem(t, rec).InvalidParams; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("invalid params = %v, want %v", got, want)
+	}
+}
+
+func TestNegotiateContentTypes(t *testing.T) {
+	all := "application/json application/octet-stream application/x-gob application/xml text/plain"
+	for _, test := range []struct {
+		accept    string
+		preferred []string
+		want      string
+	}{
+		{"", nil, all},
+		{"", []string{"text/plain", "image/png"}, "text/plain application/json application/octet-stream application/x-gob application/xml"},
+		{"*/*", []string{"application/xml"}, "application/xml application/json application/octet-stream application/x-gob text/plain"},
+		{"application/xml", []string{"application/json"}, "application/xml"},
+		{"application/json;q=0.5, application/xml", nil, "application/xml application/json"},
+		{"application/*;q=0.2, application/json", []string{"application/xml"}, "application/json application/xml application/octet-stream application/x-gob"},
+		{"text/*, text/plain;q=0", nil, ""},
+		{"*/*;q=0.1, TEXT/PLAIN", nil, "text/plain application/json application/octet-stream application/x-gob application/xml"},
+		{"image/png", nil, ""},
+	} {
+		got := strings.Join(NegotiateContentTypes(test.accept, test.preferred...), " ")
+		if got != test.want {
+			t.Errorf("NegotiateContentTypes(%q, %q) = %q, want %q", test.accept, test.preferred, got, test.want)
+		}
+	}
+}
+
+type card struct {
+	Name string `json:"name" xml:"name"`
+}
+
+func (c card) String() string { return "card " + c.Name }
+
+func TestEncodeResponse(t *testing.T) {
+	for _, test := range []struct {
+		accept          string
+		resp            interface{}
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{"", card{"a"}, http.StatusCreated, "text/plain; charset=utf-8", "card a"},
+		{"application/json", card{"a"}, http.StatusCreated, "application/json", `{"name":"a"}`},
+		{"application/xml, application/json;q=0.9", card{"a"}, http.StatusCreated, "application/xml", "<card><name>a</name></card>"},
+		{"", []byte("raw"), http.StatusCreated, "application/octet-stream", "raw"},
+		{"", map[string]int{"a": 1}, http.StatusCreated, "application/json", `{"a":1}`},
+		{"text/plain", map[string]int{"a": 1}, http.StatusNotAcceptable, "application/problem+json", ""},
+	} {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", test.accept)
+		EncodeResponse(rec, r, "application/json", http.StatusCreated, test.resp)
+		if rec.Code != test.wantStatus || rec.Header().Get("Content-Type") != test.wantContentType {
+			t.Errorf("Accept %q: answered %d %s, want %d %s", test.accept, rec.Code, rec.Header().Get("Content-Type"), test.wantStatus, test.wantContentType)
+		}
+		if test.wantBody != "" && rec.Body.String() != test.wantBody {
+			t.Errorf("Accept %q: body = %q, want %q", test.accept, rec.Body, test.wantBody)
+		}
+	}
+}
+
+func TestDecodeStrictBody(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+	}
+	unknownField, unsupported := errors.New("unknown field"), errors.New("unsupported") // kinds of errors
+	for _, test := range []struct {
+		name        string
+		contentType string
+		mediaType   string
+		body        string
+		want        error
+	}{
+		{"valid", "application/json; charset=utf-8", "application/json", `{"name":"a"}` + "\n", nil},
+		{"without Content-Type", "", "application/json", `{"name":"a"}`, nil},
+		{"unknown field", "application/json", "application/json", `{"name":"a","admin":true}`, unknownField},
+		{"trailing data", "application/json", "application/json", `{"name":"a"} {"name":"b"}`, ErrTrailingData},
+		{"other Content-Type", "application/xml", "application/json", `{"name":"a"}`, unsupported},
+		{"not json", "application/xml", "application/xml", `<user><name>a</name></user>`, unsupported},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/users", strings.NewReader(test.body))
+			if test.contentType != "" {
+				r.Header.Set("Content-Type", test.contentType)
+			}
+			var u user
+			err := DecodeStrictBody(r, test.mediaType, &u)
+			var unsupportedErr *UnsupportedMediaTypeError
+			switch test.want {
+			case nil:
+				if err != nil || u.Name != "a" {
+					t.Errorf("DecodeStrictBody = %v, decoded %+v", err, u)
+				}
+			case unknownField:
+				if err == nil || !strings.Contains(err.Error(), `unknown field "admin"`) {
+					t.Errorf("DecodeStrictBody = %v, want the unknown field", err)
+				}
+			case unsupported:
+				if !errors.As(err, &unsupportedErr) {
+					t.Errorf("DecodeStrictBody = %v, want an *UnsupportedMediaTypeError", err)
+				}
+			default:
+				if !errors.Is(err, test.want) {
+					t.Errorf("DecodeStrictBody = %v, want %v", err, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	for _, body := range []string{
+		`{"name":"` + strings.Repeat("a", 64) + `"}`, // value past the limit
+		`{"name":"a"}` + strings.Repeat(" ", 64),     // spaces past the limit
+	} {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/users", strings.NewReader(body))
+		r.Body = http.MaxBytesReader(rec, r.Body, 32)
+		var u struct {
+			Name string `json:"name"`
+		}
+		err := DecodeStrictBody(r, "application/json", &u)
+		HandleHTTPErrorWithDefaultStatus(rec, r, http.StatusBadRequest, &FieldError{Field: "User", In: "body", Name: "json", Err: err})
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("decoding %d bytes out of 32: answered %d (%v), want %d", len(body), rec.Code, err, http.StatusRequestEntityTooLarge)
+		}
+		if p := problem(t, rec); p.Detail != "request body larger than 32 bytes" {
+			t.Errorf("detail = %q, want the limit", p.Detail)
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	values := func() <-chan card {
+		c := make(chan card, 2)
+		c <- card{"a"}
+		c <- card{"b"}
+		close(c)
+		return c
+	}
+	for _, test := range []struct {
+		name            string
+		accept          string
+		resp            interface{}
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{"channel", "", values(), http.StatusCreated, NDJSON, "{\"name\":\"a\"}\n{\"name\":\"b\"}\n"},
+		{"sequence", "", slices.Values([]int{1, 2}), http.StatusCreated, NDJSON, "1\n2\n"},
+		{"events", "text/event-stream", values(), http.StatusCreated, EventStream, "data: {\"name\":\"a\"}\n\ndata: {\"name\":\"b\"}\n\n"},
+		{"events accepted better", "application/x-ndjson;q=0.5, text/*", slices.Values([]int{1}), http.StatusCreated, EventStream, "data: 1\n\n"},
+		{"nil channel", "", (<-chan card)(nil), http.StatusCreated, NDJSON, ""},
+		{"not acceptable", "application/json", values(), http.StatusNotAcceptable, "application/problem+json", ""},
+		{"reader", "", strings.NewReader("raw"), http.StatusCreated, "application/octet-stream", "raw"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/cards", nil)
+			r.Header.Set("Accept", test.accept)
+			if !Stream(rec, r, http.StatusCreated, test.resp) {
+				t.Fatalf("Stream of a %T tells it is not a stream", test.resp)
+			}
+			if rec.Code != test.wantStatus || rec.Header().Get("Content-Type") != test.wantContentType {
+				t.Errorf("answered %d %s, want %d %s", rec.Code, rec.Header().Get("Content-Type"), test.wantStatus, test.wantContentType)
+			}
+			if test.wantBody != "" && rec.Body.String() != test.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body, test.wantBody)
+			}
+			if test.wantStatus == http.StatusCreated && !rec.Flushed {
+				t.Error("the stream was not flushed")
+			}
+		})
+	}
+
+	if Stream(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), 0, card{"a"}) {
+		t.Error("Stream of a struct tells it is a stream")
+	}
+}
+
+func TestStreamStopsWithTheRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan int)
+	go func() {
+		c <- 1
+		cancel()
+	}()
+	rec := httptest.NewRecorder()
+	Stream(rec, httptest.NewRequest("GET", "/", nil).WithContext(ctx), 0, (<-chan int)(c))
+	if rec.Body.String() != "1\n" {
+		t.Errorf("body = %q, want the value sent before the request was done", rec.Body)
+	}
+}
+
+// serve runs handler like the handlers varhandler generates do,
+// with the panics Recover lets through recovered.
+func serve(w http.ResponseWriter, r *http.Request, handler func(w http.ResponseWriter)) (panicked interface{}) {
+	defer func() { panicked = recover() }()
+	rw := NewResponseWriter(w)
+	defer Recover(rw, r)
+	handler(rw)
+	return nil
+}
+
+type responses []int
+
+func (responses) OnInstantiate(*http.Request, string, string, time.Duration, error) {}
+func (responses) OnCall(*http.Request, string, time.Duration, error)                {}
+func (responses) OnError(*http.Request, string, error)                              {}
+func (s *responses) OnResponse(r *http.Request, handler string, status int, d time.Duration) {
+	*s = append(*s, status)
+}
+
+func TestRecover(t *testing.T) {
+	var logged []*PanicError
+	defer func(saved func(*http.Request, *PanicError)) { LogPanic = saved }(LogPanic)
+	LogPanic = func(r *http.Request, err *PanicError) { logged = append(logged, err) }
+	var observed responses
+	defer func(saved Observer) { HandlerObserver = saved }(HandlerObserver)
+	HandlerObserver = &observed
+
+	r := httptest.NewRequest("GET", "/users/1", nil)
+	rec := httptest.NewRecorder()
+	p := serve(rec, r, func(w http.ResponseWriter) {
+		Observe(w, r, "GetUser")
+		w.Header().Set("X-Partial", "1")
+		w.WriteHeader(http.StatusCreated)
+		panic("boom")
+	})
+	if p != nil {
+		t.Fatalf("Recover let %v through", p)
+	}
+	if rec.Code != http.StatusInternalServerError || problem(t, rec).Detail != "" {
+		t.Errorf("answered %d %s, want a %d without detail", rec.Code, rec.Body, http.StatusInternalServerError)
+	}
+	if len(logged) != 1 || logged[0].Value != "boom" || len(logged[0].Stack) == 0 {
+		t.Errorf("logged %v, want the panic with its stack", logged)
+	}
+	if len(observed) != 1 || observed[0] != http.StatusInternalServerError {
+		t.Errorf("observed responses %v, want the 500", observed)
+	}
+
+	rec = httptest.NewRecorder()
+	p = serve(rec, r, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("partial"))
+		panic("boom")
+	})
+	if p != http.ErrAbortHandler {
+		t.Errorf("Recover of a committed response panicked with %v, want http.ErrAbortHandler", p)
+	}
+	if rec.Code != http.StatusAccepted || rec.Body.String() != "partial" {
+		t.Errorf("answered %d %q, want the committed response left as is", rec.Code, rec.Body)
+	}
+
+	if p = serve(httptest.NewRecorder(), r, func(http.ResponseWriter) { panic(http.ErrAbortHandler) }); p != http.ErrAbortHandler {
+		t.Errorf("Recover of http.ErrAbortHandler panicked with %v, want it to panic again", p)
+	}
+	if len(logged) != 2 {
+		t.Errorf("logged %d panics, want 2: http.ErrAbortHandler is not logged", len(logged))
+	}
+}
+
+func TestRecoverCommits(t *testing.T) {
+	rec := httptest.NewRecorder()
+	serve(rec, httptest.NewRequest("GET", "/", nil), func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusCreated)
+		w.Header().Set("Location", "/users/1")
+		w.WriteHeader(http.StatusAccepted)
+	})
+	if rec.Code != http.StatusAccepted || rec.Header().Get("Location") != "/users/1" {
+		t.Errorf("answered %d with Location %q, want the last status and the header set before", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestHandleContextError(t *testing.T) {
+	for _, test := range []struct {
+		err        error
+		wantStatus int
+		wantTitle  string
+		wantDetail string
+	}{
+		{context.Canceled, StatusClientClosedRequest, "Client Closed Request", "context canceled"},
+		{fmt.Errorf("get user: %w", context.DeadlineExceeded), http.StatusServiceUnavailable, "Service Unavailable", ""},
+	} {
+		rec := httptest.NewRecorder()
+		HandleContextError(rec, httptest.NewRequest("GET", "/users/1", nil), test.err)
+		if rec.Code != test.wantStatus {
+			t.Errorf("HandleContextError(%v) answered %d, want %d", test.err, rec.Code, test.wantStatus)
+		}
+		if p := problem(t, rec); p.Title != test.wantTitle || p.Detail != test.wantDetail {
+			t.Errorf("HandleContextError(%v) answered %+v, want the title %q and the detail %q", test.err, p, test.wantTitle, test.wantDetail)
+		}
+	}
+	if got := (&StatusError{Code: StatusClientClosedRequest}).Error(); !strings.Contains(got, "Client Closed Request") {
+		t.Errorf("StatusError of a 499 = %q, want its title", got)
+	}
+}